@@ -4,21 +4,32 @@ import (
 	"github.com/spf13/cobra"
 )
 
-// agentCmd represents the agent parent command
-var agentCmd = &cobra.Command{
-	Use:   "agent",
-	Short: "Manage agents with many subcommands",
-	Long: `
+// newAgentCmd builds the agent parent command
+func newAgentCmd(c *cli) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "agent",
+		Short: "Manage agents with many subcommands",
+		Long: `
 Manage agents with subcommands like ls, create, view, pull, push, and delete.`,
 
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		checkEnvVars()
-	},
-	Run: func(cmd *cobra.Command, args []string) {
-		cmd.Help()
-	},
-}
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			c.checkEnvVars()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
 
-func init() {
-	rootCmd.AddCommand(agentCmd)
+	cmd.AddCommand(
+		newAgentListCmd(c),
+		newAgentCreateCmd(c),
+		newAgentViewCmd(c),
+		newAgentPullCmd(c),
+		newAgentPushCmd(c),
+		newAgentDeleteCmd(c),
+		newAgentChatCmd(c),
+		newAgentCompareCmd(c),
+		newAgentEvalCmd(c),
+	)
+	return cmd
 }
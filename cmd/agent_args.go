@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// agentNameArgs accepts the agent names as arguments, or one name with the
+// --name flag that earlier versions required. max < 0 allows any number
+func agentNameArgs(max int) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		named := cmd.Flags().Changed("name")
+		switch {
+		case named && len(args) > 0:
+			return fmt.Errorf("give the agent name as an argument or with --name, not both")
+		case !named && len(args) == 0:
+			return fmt.Errorf("requires the name of an agent, e.g. '%s NAME'", cmd.CommandPath())
+		case max >= 0 && len(args) > max:
+			return fmt.Errorf("accepts at most %d agent name(s), received %d", max, len(args))
+		}
+		if named {
+			flagValue, _ := cmd.Flags().GetString("name")
+			return checkAgentNames([]string{flagValue})
+		}
+		return checkAgentNames(args)
+	}
+}
+
+// checkAgentNames rejects names the server would not accept. The names go
+// into URLs and file names, so a name such as ../x must not reach them
+func checkAgentNames(names []string) error {
+	for _, name := range names {
+		if !agentNamePattern.MatchString(name) {
+			return fmt.Errorf("the name %s may only have letters, digits, hyphens and underscores", name)
+		}
+	}
+	return nil
+}
+
+// agentNamesFromArgs returns the names given as arguments or with --name
+func agentNamesFromArgs(args []string, flagValue string) []string {
+	if len(args) > 0 {
+		return args
+	}
+	return []string{flagValue}
+}
+
+// deprecateNameFlag keeps --name working, with a warning, for scripts
+// written for earlier versions. path is the full path of the command, which
+// is not known until the command is added to its parents
+func deprecateNameFlag(cmd *cobra.Command, path string) {
+	cmd.Flags().MarkDeprecated("name", fmt.Sprintf("give the name as an argument, e.g. '%s NAME'", path))
+}
+
+// completeAgentNameArgs completes the agents not given yet, up to max names
+// (max < 0 for any number)
+func (c *cli) completeAgentNameArgs(max int) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if max >= 0 && len(args) >= max {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		names, directive := c.completeAgentNames(cmd, args, toComplete)
+		return slices.DeleteFunc(names, func(name string) bool {
+			return slices.Contains(args, name)
+		}), directive
+	}
+}
+
+// agentNamePattern is the rule of the server for agent names
+var agentNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// agentYamlFilename is the file create and pull save an agent to and push
+// reads it from
+func agentYamlFilename(name string) string {
+	return name + ".yaml"
+}
+
+// isYamlFilename reports whether an argument names a YAML file rather than an agent
+func isYamlFilename(arg string) bool {
+	lower := strings.ToLower(arg)
+	return strings.HasSuffix(lower, ".yaml") || strings.HasSuffix(lower, ".yml")
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+// TestAgentNameArgs checks the names given as arguments or with --name are
+// checked before they go into URLs and file names
+func TestAgentNameArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		flag    string
+		wantErr bool
+	}{
+		{name: "names", args: []string{"kb", "support_bot-2"}},
+		{name: "name flag", flag: "kb"},
+		{name: "no name", wantErr: true},
+		{name: "parent directory", args: []string{"../kb"}, wantErr: true},
+		{name: "path", args: []string{"kb", "a/b"}, wantErr: true},
+		{name: "query", args: []string{"kb?x=1"}, wantErr: true},
+		{name: "blank", args: []string{"notes bot"}, wantErr: true},
+		{name: "empty", args: []string{""}, wantErr: true},
+		{name: "name flag with a path", flag: `..\kb`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{Use: "pull"}
+			cmd.Flags().String("name", "", "")
+			if tt.flag != "" {
+				cmd.Flags().Set("name", tt.flag)
+			}
+			err := agentNameArgs(-1)(cmd, tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("agentNameArgs(%q, --name %q) = %v, want an error: %v", tt.args, tt.flag, err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,78 +1,194 @@
 package cmd
 
 import (
-	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
-	"os"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 
 	"github.com/spf13/cobra"
 )
 
-// Array to store chat history
-var chatAgentName string
-
-// Array to store chat history
-var messages []ChatMessage
-
-// chatCmd represents the chat command
-var agtChatCmd = &cobra.Command{
-	Use:   "chat",
-	Short: "Start a chat session",
-	Long:  `The chat session allows you to interact with the LLM. Type 'q' to quit.`,
-	Run:   startChatLoop,
-}
+// newAgentChatCmd builds the chat command
+func newAgentChatCmd(c *cli) *cobra.Command {
+	// Name of the agent to chat with
+	var chatAgentName string
+	// Print answers as received instead of rendering Markdown
+	var chatRaw bool
+	var chatNoColor bool
+
+	cmd := &cobra.Command{
+		Use:   "chat NAME",
+		Short: "Start a chat session",
+		Long: `
+The chat session allows you to interact with the LLM. Type 'q' to quit.
+
+1. Answers are rendered as Markdown when the output is a terminal. Use --raw to print them as received.
+2. Colors are turned off with --no-color or by setting the NO_COLOR environment variable.`,
+		Args:              agentNameArgs(1),
+		ValidArgsFunction: c.completeAgentNameArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			chatAgentName = agentNamesFromArgs(args, chatAgentName)[0]
+			c.startChatLoop(chatAgentName, chatRaw, chatNoColor)
+		},
+	}
 
-func init() {
-	agentCmd.AddCommand(agtChatCmd) // Add the chat command to the root command
+	cmd.Flags().StringVarP(&chatAgentName, "name", "n", "", "Specify the agent name (required)")
+	cmd.Flags().BoolVar(&chatRaw, "raw", false, "Print answers as received without rendering Markdown")
+	cmd.Flags().BoolVar(&chatNoColor, "no-color", false, "Render answers without colors")
+	cmd.RegisterFlagCompletionFunc("name", c.completeAgentNames)
+	deprecateNameFlag(cmd, "sia agent chat")
 
-	agtChatCmd.Flags().StringVarP(&chatAgentName, "name", "n", "", "Specify the agent name (required)")
-	agtChatCmd.MarkFlagRequired("name")
+	return cmd
 }
 
 // startChatLoop starts an interactive chat loop
-func startChatLoop(cmd *cobra.Command, args []string) {
-	fmt.Println()
-	fmt.Println("Starting chat session. Type 'q' to quit.")
-	fmt.Println()
+func (c *cli) startChatLoop(chatAgentName string, raw, noColor bool) {
+	// Array to store chat history
+	var messages []ChatMessage
+
+	// Make sure the agent exists and is ready before chatting
+	agent := c.fetchChatAgent(chatAgentName)
+
+	fmt.Fprintln(c.stdout)
+	fmt.Fprintf(c.stdout, "Starting chat session with %s. Type 'q' to quit.\n", agent.Name)
+	fmt.Fprintf(c.stdout, "Type %s on a line of its own to start and end a multi-line prompt.\n", multiLineMarker)
+	fmt.Fprintln(c.stdout)
+
+	// Greet with the agent's own welcome message and suggested prompts
+	if agent.WelcomeMessage != "" {
+		c.displayChatAnswer(agent.WelcomeMessage, raw, noColor)
+		fmt.Fprintln(c.stdout)
+	}
+	if len(agent.SuggestedPrompts) > 0 {
+		fmt.Fprintln(c.stdout, "Suggested prompts (type the number to send one):")
+		for i, prompt := range agent.SuggestedPrompts {
+			fmt.Fprintf(c.stdout, "  %d. %s\n", i+1, prompt)
+		}
+		fmt.Fprintln(c.stdout)
+	}
 
-	scanner := bufio.NewScanner(os.Stdin)
+	reader := c.newChatReader()
+	defer reader.Close()
 
 	for {
-		// Display a prompt
-		fmt.Print("You   : ")
-
 		// Read user input
-		scanned := scanner.Scan()
-		if !scanned {
-			fmt.Println("\n[Error]: Unable to read input. Exiting.")
+		input, err := reader.ReadPrompt("You   : ", "...   : ")
+		if err == io.EOF {
+			fmt.Fprintln(c.stdout)
+			fmt.Fprintln(c.stdout, "Exiting chat session.")
+			fmt.Fprintln(c.stdout)
+			break
+		}
+		if err != nil {
+			fmt.Fprintln(c.stdout, "\n[Error]: Unable to read input. Exiting.")
 			break
 		}
 
-		input := strings.TrimSpace(scanner.Text())
+		input = strings.TrimSpace(input)
+		if input == "" {
+			continue
+		}
 
 		// Handle quit command
 		if input == "q" {
-			fmt.Println()
-			fmt.Println("Exiting chat session.")
-			fmt.Println()
+			fmt.Fprintln(c.stdout)
+			fmt.Fprintln(c.stdout, "Exiting chat session.")
+			fmt.Fprintln(c.stdout)
 			break
 		}
 
+		// Replace the number of a suggested prompt with the prompt itself
+		if prompt, ok := suggestedPrompt(agent.SuggestedPrompts, input); ok {
+			input = prompt
+			fmt.Fprint(c.stdout, "\033[F\033[K")
+			fmt.Fprintln(c.stdout, "You   :", input)
+		}
+
 		messages = append(messages, ChatMessage{Role: "user", Content: input})
-		fmt.Println("Agent : ... ")
+		fmt.Fprintln(c.stdout, "Agent : ... ")
 		// Call a function to handle the chat input and get a response
-		response := sendChatPrompt(chatAgentName, input, messages)
-		fmt.Print("\033[F\033[K")
-		fmt.Println("Agent :", response.Content)
+		response := c.sendChatPrompt(chatAgentName, input, messages)
+		fmt.Fprint(c.stdout, "\033[F\033[K")
+		c.displayChatAnswer(response.Content, raw, noColor)
 	}
 
 }
 
-func sendChatPrompt(agentName, prompt string, messages []ChatMessage) ChatResponse {
+// fetchChatAgent gets the agent to chat with, exiting with a clear message
+// when it does not exist or its embeddings are not ready yet
+func (c *cli) fetchChatAgent(agentName string) AgentResponse {
+	// the agent endpoint needs the login cookie when there is one
+	agentURL := "/api/agents/" + url.PathEscape(agentName)
+	req := c.createHttpClient("GET", agentURL, nil, "")
+	if accessToken, err := c.readAccessToken(); err == nil {
+		req.AddCookie(&http.Cookie{Name: "access_token", Value: accessToken})
+	}
+
+	res, resBody := c.executeHttpRequest(req)
+	if res.StatusCode == http.StatusNotFound {
+		c.handleErr(nil, fmt.Sprintf("Agent %s does not exist. Use 'sia agent ls' to see the available agents", agentName))
+	}
+	c.checkResponseStatusCode(res, resBody)
+	agent := c.unmarshalAgentResponse(resBody)
+
+	if !embeddingsReady(agent) {
+		c.handleErr(nil, fmt.Sprintf("Agent %s is not ready yet, its embeddings are %s. Try again shortly", agentName, agent.EmbeddingsStatus))
+	}
+	return agent
+}
+
+// embeddingsReady reports whether the agent's files have been embedded
+func embeddingsReady(agent AgentResponse) bool {
+	switch strings.ToLower(agent.EmbeddingsStatus) {
+	case "pending", "queued", "processing", "in_progress", "in progress", "running", "failed", "error":
+		return false
+	}
+	return true
+}
+
+// suggestedPrompt returns the suggested prompt picked by its number
+func suggestedPrompt(prompts []string, input string) (string, bool) {
+	number, err := strconv.Atoi(input)
+	if err != nil || number < 1 || number > len(prompts) {
+		return "", false
+	}
+	return prompts[number-1], true
+}
+
+// displayChatAnswer prints the answer, rendering Markdown on a terminal
+func (c *cli) displayChatAnswer(content string, raw, noColor bool) {
+	if _, ok := terminalFd(c.stdout); raw || !ok {
+		fmt.Fprintln(c.stdout, "Agent :", content)
+		return
+	}
+
+	// indent the rendered answer under the "Agent : " label
+	indent := strings.Repeat(" ", len("Agent : "))
+	renderer := markdownRenderer{
+		width: c.terminalWidth() - len(indent),
+		color: !noColor && c.colorEnabled(),
+	}
+	lines := strings.Split(renderer.render(content), "\n")
+	fmt.Fprintln(c.stdout, "Agent :", lines[0])
+	for _, line := range lines[1:] {
+		if line == "" {
+			fmt.Fprintln(c.stdout)
+			continue
+		}
+		fmt.Fprintln(c.stdout, indent+line)
+	}
+}
+
+func (c *cli) sendChatPrompt(agentName, prompt string, messages []ChatMessage) ChatResponse {
 
 	// set the chat URL & method
-	chatURL := fmt.Sprintf("/api/chat/%s", agentName)
+	chatURL := "/api/chat/" + url.PathEscape(agentName)
 	method := "POST"
 	// Prepare the request payload
 	payload := ChatRequest{
@@ -81,20 +197,58 @@ func sendChatPrompt(agentName, prompt string, messages []ChatMessage) ChatRespon
 	}
 
 	// Get the request body
-	reqBody := generateJSONBody(payload)
+	reqBody := c.generateJSONBody(payload)
 
 	// Create the POST request
-	req := createHttpClient(method, chatURL, reqBody, "application/json")
+	req := c.createHttpClient(method, chatURL, reqBody, "application/json")
 
 	// Execute HTTP client
-	res, resBody := executeHttpRequest(req)
+	res, resBody := c.executeHttpRequest(req)
 
 	//Check status code
-	checkResponseStatusCode(res, resBody)
+	c.checkResponseStatusCode(res, resBody)
 
 	// Unmarshal response to ChatResponse
-	chatResponse := unmarshalChatResponse(resBody)
+	chatResponse := c.unmarshalChatResponse(resBody)
 
 	return chatResponse
 
 }
+
+// requestChatPrompt sends a single prompt like sendChatPrompt but returns
+// errors instead of exiting, so that callers running many prompts can keep going
+func (c *cli) requestChatPrompt(ctx context.Context, agentName, prompt string, messages []ChatMessage) (ChatResponse, error) {
+	var chatResponse ChatResponse
+
+	// Prepare the request payload
+	payload := ChatRequest{
+		Prompt:   prompt,
+		Messages: messages,
+	}
+	reqBody, err := json.Marshal(payload)
+	if err != nil {
+		return chatResponse, fmt.Errorf("failed to marshal chat body: %w", err)
+	}
+
+	// Create and execute the POST request
+	chatURL := "/api/chat/" + url.PathEscape(agentName)
+	req, err := c.newRequest(ctx, "POST", chatURL, bytes.NewReader(reqBody), "application/json")
+	if err != nil {
+		return chatResponse, err
+	}
+	res, resBody, err := c.doHttpRequest(req)
+	if err != nil {
+		return chatResponse, err
+	}
+
+	//Check status code
+	if err := responseStatusError(res, resBody); err != nil {
+		return chatResponse, err
+	}
+
+	// Unmarshal response to ChatResponse
+	if err := json.Unmarshal(resBody, &chatResponse); err != nil {
+		return chatResponse, fmt.Errorf("failed to unmarshal chat body: %w", err)
+	}
+	return chatResponse, nil
+}
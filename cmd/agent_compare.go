@@ -0,0 +1,386 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// compareAgentArgs accepts the two agents as arguments, or both with the
+// --agent-a and --agent-b flags that earlier versions required
+func compareAgentArgs(cmd *cobra.Command, args []string) error {
+	named := cmd.Flags().Changed("agent-a") || cmd.Flags().Changed("agent-b")
+	switch {
+	case named && len(args) > 0:
+		return fmt.Errorf("give the agents as arguments or with --agent-a and --agent-b, not both")
+	case named && !(cmd.Flags().Changed("agent-a") && cmd.Flags().Changed("agent-b")):
+		return fmt.Errorf("--agent-a and --agent-b must be given together")
+	case !named && len(args) != 2:
+		return fmt.Errorf("requires the names of two agents, e.g. '%s A B', received %d", cmd.CommandPath(), len(args))
+	}
+	if named {
+		agentA, _ := cmd.Flags().GetString("agent-a")
+		agentB, _ := cmd.Flags().GetString("agent-b")
+		return checkAgentNames([]string{agentA, agentB})
+	}
+	return checkAgentNames(args)
+}
+
+// CompareAnswer is the answer of one agent to a prompt
+type CompareAnswer struct {
+	Content string
+	Latency time.Duration
+	Err     error
+}
+
+// CompareResult holds the answers of both agents to one prompt
+type CompareResult struct {
+	Prompt string
+	A      CompareAnswer
+	B      CompareAnswer
+}
+
+// CompareStats summarises the answers of one agent
+type CompareStats struct {
+	Agent         string
+	Answered      int
+	Errors        int
+	MeanLatency   time.Duration
+	MedianLatency time.Duration
+	MaxLatency    time.Duration
+	MeanChars     int
+	MeanWords     int
+}
+
+func newAgentCompareCmd(c *cli) *cobra.Command {
+	var agentCompareA string
+	var agentCompareB string
+	var agentCompareFilePath string
+	var agentCompareConcurrency int
+	var agentCompareReport string
+	var agentCompareFormat string
+
+	cmd := &cobra.Command{
+		Use:   "compare A B",
+		Short: "Compare the answers of two agents side by side",
+		Long: `
+Compare the answers of agents A and B to the same prompts.
+
+1. Prompts are read from a text file, one per line. Blank lines and lines starting with # are skipped.
+2. Each prompt is sent to both agents at the same time and the answers are shown side by side.
+3. Use --report to also write a Markdown (.md) or HTML (.html) report with latency and length statistics.`,
+		Args:              compareAgentArgs,
+		ValidArgsFunction: c.completeAgentNameArgs(2),
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			c.checkEnvVars()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) == 2 {
+				agentCompareA, agentCompareB = args[0], args[1]
+			}
+
+			// Read the prompts
+			prompts := c.readPromptsFile(agentCompareFilePath)
+			if len(prompts) == 0 {
+				c.handleErr(nil, fmt.Sprintf("No prompts found in %s", agentCompareFilePath))
+			}
+
+			// work out the report format from the flag or the file extension
+			format := agentCompareFormat
+			if format == "" && agentCompareReport != "" {
+				switch strings.ToLower(filepath.Ext(agentCompareReport)) {
+				case ".html", ".htm":
+					format = "html"
+				default:
+					format = "markdown"
+				}
+			}
+			if format != "" && format != "markdown" && format != "html" {
+				c.handleErr(nil, "Format must be either 'markdown' or 'html'")
+			}
+
+			if agentCompareConcurrency < 1 {
+				agentCompareConcurrency = 1
+			}
+
+			// Send the prompts to both agents
+			results := c.runCompare(agentCompareA, agentCompareB, prompts, agentCompareConcurrency)
+			if c.ctx.Err() != nil {
+				c.exitCancelled()
+			}
+			statsA := compareStats(agentCompareA, results, func(r CompareResult) CompareAnswer { return r.A })
+			statsB := compareStats(agentCompareB, results, func(r CompareResult) CompareAnswer { return r.B })
+
+			// Display on terminal
+			displayCompareSideBySide(c.stdout, agentCompareA, agentCompareB, results, c.terminalWidth())
+			displayCompareStats(c.stdout, statsA, statsB)
+
+			// Write the report
+			if agentCompareReport != "" {
+				file, err := os.Create(c.workPath(agentCompareReport))
+				if err != nil {
+					c.handleErr(err, "Failed to create report file")
+				}
+				if format == "html" {
+					writeCompareHTML(file, results, statsA, statsB)
+				} else {
+					writeCompareMarkdown(file, results, statsA, statsB)
+				}
+				file.Close()
+				fmt.Fprintf(c.stdout, "Report written to %s\n", agentCompareReport)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&agentCompareA, "agent-a", "a", "", "Name of the first agent")
+	cmd.Flags().StringVarP(&agentCompareB, "agent-b", "b", "", "Name of the second agent")
+	cmd.Flags().StringVarP(&agentCompareFilePath, "file", "f", "", "Path to a text file with one prompt per line")
+	cmd.Flags().IntVarP(&agentCompareConcurrency, "concurrency", "c", 2, "Number of prompts to run in parallel")
+	cmd.Flags().StringVar(&agentCompareReport, "report", "", "Write a Markdown or HTML report to this file")
+	cmd.Flags().StringVar(&agentCompareFormat, "format", "", "Report format: markdown or html (default from the report file extension)")
+	cmd.RegisterFlagCompletionFunc("agent-a", c.completeAgentNames)
+	cmd.RegisterFlagCompletionFunc("agent-b", c.completeAgentNames)
+	cmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions([]string{"markdown", "html"}, cobra.ShellCompDirectiveNoFileComp))
+
+	cmd.MarkFlagRequired("file")
+	cmd.Flags().MarkDeprecated("agent-a", "give the agents as arguments, e.g. 'sia agent compare A B'")
+	cmd.Flags().MarkDeprecated("agent-b", "give the agents as arguments, e.g. 'sia agent compare A B'")
+
+	return cmd
+}
+
+// readPromptsFile reads one prompt per line, skipping blanks and # comments
+func (c *cli) readPromptsFile(filePath string) []string {
+	file, err := os.Open(c.workPath(filePath))
+	if err != nil {
+		c.handleErr(err, "Failed to read prompts file")
+	}
+	defer file.Close()
+
+	var prompts []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		prompts = append(prompts, line)
+	}
+	if err := scanner.Err(); err != nil {
+		c.handleErr(err, "Failed to read prompts file")
+	}
+	return prompts
+}
+
+func (c *cli) runCompare(agentA, agentB string, prompts []string, concurrency int) []CompareResult {
+	results := make([]CompareResult, len(prompts))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	ask := func(agentName, prompt string) CompareAnswer {
+		messages := []ChatMessage{{Role: "user", Content: prompt}}
+		start := time.Now()
+		response, err := c.requestChatPrompt(c.ctx, agentName, prompt, messages)
+		return CompareAnswer{Content: response.Content, Latency: time.Since(start), Err: err}
+	}
+
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				// ask both agents at the same time
+				var pair sync.WaitGroup
+				result := CompareResult{Prompt: prompts[i]}
+				pair.Add(2)
+				go func() { defer pair.Done(); result.A = ask(agentA, prompts[i]) }()
+				go func() { defer pair.Done(); result.B = ask(agentB, prompts[i]) }()
+				pair.Wait()
+				results[i] = result
+			}
+		}()
+	}
+	for i := range prompts {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+func compareStats(agentName string, results []CompareResult, pick func(CompareResult) CompareAnswer) CompareStats {
+	stats := CompareStats{Agent: agentName}
+	var latencies []time.Duration
+	var total time.Duration
+	var chars, words int
+
+	for _, result := range results {
+		answer := pick(result)
+		if answer.Err != nil {
+			stats.Errors++
+			continue
+		}
+		stats.Answered++
+		latencies = append(latencies, answer.Latency)
+		total += answer.Latency
+		chars += len([]rune(answer.Content))
+		words += len(strings.Fields(answer.Content))
+	}
+	if stats.Answered == 0 {
+		return stats
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	stats.MeanLatency = total / time.Duration(stats.Answered)
+	stats.MedianLatency = latencies[len(latencies)/2]
+	stats.MaxLatency = latencies[len(latencies)-1]
+	stats.MeanChars = chars / stats.Answered
+	stats.MeanWords = words / stats.Answered
+	return stats
+}
+
+// answerText returns the answer or the error to show in its place
+func (answer CompareAnswer) answerText() string {
+	if answer.Err != nil {
+		return fmt.Sprintf("[Error]: %v", answer.Err)
+	}
+	return answer.Content
+}
+
+func displayCompareSideBySide(out io.Writer, agentA, agentB string, results []CompareResult, width int) {
+	columnWidth := (width - 3) / 2
+	if columnWidth < 20 {
+		columnWidth = 20
+	}
+	rowFormat := fmt.Sprintf("%%-%ds | %%s\n", columnWidth)
+	separator := strings.Repeat("-", columnWidth*2+3)
+
+	for i, result := range results {
+		fmt.Fprintln(out, separator)
+		fmt.Fprintf(out, "%d. %s\n", i+1, result.Prompt)
+		fmt.Fprintln(out, separator)
+
+		headerA := fmt.Sprintf("%s (%s)", agentA, result.A.Latency.Round(time.Millisecond))
+		headerB := fmt.Sprintf("%s (%s)", agentB, result.B.Latency.Round(time.Millisecond))
+		fmt.Fprintf(out, rowFormat, headerA, headerB)
+
+		linesA := wrapText(result.A.answerText(), columnWidth)
+		linesB := wrapText(result.B.answerText(), columnWidth)
+		for len(linesA) < len(linesB) {
+			linesA = append(linesA, "")
+		}
+		for len(linesB) < len(linesA) {
+			linesB = append(linesB, "")
+		}
+		for j := range linesA {
+			fmt.Fprintf(out, rowFormat, linesA[j], linesB[j])
+		}
+	}
+	fmt.Fprintln(out, separator)
+	fmt.Fprintln(out)
+}
+
+func displayCompareStats(out io.Writer, stats ...CompareStats) {
+	// Print the header row
+	headerFormat := "%-20s %-8s %-6s %-10s %-10s %-10s %-10s %-10s\n"
+	fmt.Fprintf(out, headerFormat, "AGENT", "ANSWERED", "ERRORS", "MEAN", "MEDIAN", "MAX", "AVG CHARS", "AVG WORDS")
+	fmt.Fprintln(out, strings.Repeat("-", 91))
+
+	rowFormat := "%-20s %-8d %-6d %-10s %-10s %-10s %-10d %-10d\n"
+	for _, s := range stats {
+		fmt.Fprintf(out, rowFormat, s.Agent, s.Answered, s.Errors,
+			s.MeanLatency.Round(time.Millisecond), s.MedianLatency.Round(time.Millisecond), s.MaxLatency.Round(time.Millisecond),
+			s.MeanChars, s.MeanWords)
+	}
+	fmt.Fprintln(out)
+}
+
+func writeCompareMarkdown(out io.Writer, results []CompareResult, statsA, statsB CompareStats) {
+	fmt.Fprintf(out, "# Comparison of %s and %s\n\n", statsA.Agent, statsB.Agent)
+
+	fmt.Fprintln(out, "## Statistics")
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "| Agent | Answered | Errors | Mean latency | Median latency | Max latency | Avg chars | Avg words |")
+	fmt.Fprintln(out, "|---|---|---|---|---|---|---|---|")
+	for _, s := range []CompareStats{statsA, statsB} {
+		fmt.Fprintf(out, "| %s | %d | %d | %s | %s | %s | %d | %d |\n", s.Agent, s.Answered, s.Errors,
+			s.MeanLatency.Round(time.Millisecond), s.MedianLatency.Round(time.Millisecond), s.MaxLatency.Round(time.Millisecond),
+			s.MeanChars, s.MeanWords)
+	}
+	fmt.Fprintln(out)
+
+	fmt.Fprintln(out, "## Answers")
+	fmt.Fprintln(out)
+	cell := func(text string) string {
+		text = strings.ReplaceAll(text, "|", "\\|")
+		return strings.ReplaceAll(strings.TrimSpace(text), "\n", "<br>")
+	}
+	fmt.Fprintf(out, "| # | Prompt | %s | %s |\n", statsA.Agent, statsB.Agent)
+	fmt.Fprintln(out, "|---|---|---|---|")
+	for i, result := range results {
+		fmt.Fprintf(out, "| %d | %s | %s<br>_%s_ | %s<br>_%s_ |\n", i+1, cell(result.Prompt),
+			cell(result.A.answerText()), result.A.Latency.Round(time.Millisecond),
+			cell(result.B.answerText()), result.B.Latency.Round(time.Millisecond))
+	}
+}
+
+func writeCompareHTML(out io.Writer, results []CompareResult, statsA, statsB CompareStats) {
+	title := html.EscapeString(fmt.Sprintf("Comparison of %s and %s", statsA.Agent, statsB.Agent))
+	fmt.Fprintf(out, `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>%s</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%%; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 6px 10px; vertical-align: top; text-align: left; }
+th { background: #f4f4f4; }
+td.answer { white-space: pre-wrap; width: 40%%; }
+.latency { color: #777; font-size: 0.9em; }
+.error { color: #b00; }
+</style>
+</head>
+<body>
+<h1>%s</h1>
+<h2>Statistics</h2>
+<table>
+<tr><th>Agent</th><th>Answered</th><th>Errors</th><th>Mean latency</th><th>Median latency</th><th>Max latency</th><th>Avg chars</th><th>Avg words</th></tr>
+`, title, title)
+	for _, s := range []CompareStats{statsA, statsB} {
+		fmt.Fprintf(out, "<tr><td>%s</td><td>%d</td><td>%d</td><td>%s</td><td>%s</td><td>%s</td><td>%d</td><td>%d</td></tr>\n",
+			html.EscapeString(s.Agent), s.Answered, s.Errors,
+			s.MeanLatency.Round(time.Millisecond), s.MedianLatency.Round(time.Millisecond), s.MaxLatency.Round(time.Millisecond),
+			s.MeanChars, s.MeanWords)
+	}
+	fmt.Fprintln(out, "</table>")
+
+	cell := func(answer CompareAnswer) string {
+		class := "answer"
+		if answer.Err != nil {
+			class = "answer error"
+		}
+		return fmt.Sprintf(`<td class="%s">%s<div class="latency">%s</div></td>`, class,
+			html.EscapeString(answer.answerText()), answer.Latency.Round(time.Millisecond))
+	}
+	fmt.Fprintln(out, "<h2>Answers</h2>")
+	fmt.Fprintln(out, "<table>")
+	fmt.Fprintf(out, "<tr><th>#</th><th>Prompt</th><th>%s</th><th>%s</th></tr>\n", html.EscapeString(statsA.Agent), html.EscapeString(statsB.Agent))
+	for i, result := range results {
+		fmt.Fprintf(out, "<tr><td>%d</td><td>%s</td>%s%s</tr>\n", i+1, html.EscapeString(result.Prompt), cell(result.A), cell(result.B))
+	}
+	fmt.Fprintln(out, "</table>")
+	fmt.Fprintln(out, "</body>")
+	fmt.Fprintln(out, "</html>")
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestDisplayCompareSideBySide checks the answers are wrapped into two
+// columns that fill the width and the shorter answer is padded
+func TestDisplayCompareSideBySide(t *testing.T) {
+	results := []CompareResult{
+		{
+			Prompt: "Refunds?",
+			A:      CompareAnswer{Content: "Refunds are possible within 30 days of the purchase.", Latency: 1200 * time.Millisecond},
+			B:      CompareAnswer{Content: "Within 30 days.", Latency: 800 * time.Millisecond},
+		},
+		{
+			Prompt: "Hours?",
+			A:      CompareAnswer{Content: "Nine to five.\nClosed on Sundays.", Latency: time.Second},
+			B:      CompareAnswer{Err: errors.New("timeout"), Latency: 30 * time.Second},
+		},
+	}
+	var out strings.Builder
+	displayCompareSideBySide(&out, "kb", "kb-v2", results, 47)
+
+	want := strings.Join([]string{
+		"-----------------------------------------------",
+		"1. Refunds?",
+		"-----------------------------------------------",
+		"kb (1.2s)              | kb-v2 (800ms)",
+		"Refunds are possible   | Within 30 days.",
+		"within 30 days of the  | ",
+		"purchase.              | ",
+		"-----------------------------------------------",
+		"2. Hours?",
+		"-----------------------------------------------",
+		"kb (1s)                | kb-v2 (30s)",
+		"Nine to five.          | [Error]: timeout",
+		"Closed on Sundays.     | ",
+		"-----------------------------------------------",
+		"",
+		"",
+	}, "\n")
+	if out.String() != want {
+		t.Errorf("side by side =\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+// TestDisplayCompareSideBySideWidth checks the columns share the width and
+// do not get narrower than 20 characters
+func TestDisplayCompareSideBySideWidth(t *testing.T) {
+	answer := strings.Repeat("word ", 40)
+	results := []CompareResult{{Prompt: "Hi", A: CompareAnswer{Content: answer}, B: CompareAnswer{Content: answer}}}
+	tests := []struct {
+		width       int
+		columnWidth int
+	}{
+		{width: 120, columnWidth: 58},
+		{width: 80, columnWidth: 38},
+		{width: 81, columnWidth: 39},
+		{width: 30, columnWidth: 20},
+		{width: 0, columnWidth: 20},
+	}
+	for _, tt := range tests {
+		var out strings.Builder
+		displayCompareSideBySide(&out, "a", "b", results, tt.width)
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		if separator := len(lines[0]); separator != tt.columnWidth*2+3 {
+			t.Errorf("width %d: separator is %d wide, want %d", tt.width, separator, tt.columnWidth*2+3)
+		}
+		for _, line := range lines[3 : len(lines)-1] {
+			left, right, ok := strings.Cut(line, " | ")
+			if !ok || len(left) != tt.columnWidth || len(right) > tt.columnWidth {
+				t.Errorf("width %d: line %q does not fit columns of %d", tt.width, line, tt.columnWidth)
+			}
+		}
+	}
+}
+
+// TestTerminalWidth checks the default width when stdout is not a terminal
+func TestTerminalWidth(t *testing.T) {
+	c := newTestCLI(t, nil)
+	c.stdout = &strings.Builder{}
+	if width := c.terminalWidth(); width != 100 {
+		t.Errorf("terminalWidth = %d, want 100", width)
+	}
+}
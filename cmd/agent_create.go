@@ -2,25 +2,49 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/spf13/cobra"
 )
 
-// agentListCmd represents the subcommand for listing agents
-var agentCreateCmd = &cobra.Command{
-	Use:   "create",
-	Short: "To download a create template",
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		checkEnvVars()
-	},
-	Run: func(cmd *cobra.Command, args []string) {
-
-		// Check if access token exists
-		checkAccessToken()
-
-		// Step 1: Create the multiline YAML content
-		yamlContent := `
-name: agent-name # A meaningful name with letters, digits, hyphen, underscore, no blanks
+// defaultTemplateAgentName is the name in the template when none is given
+const defaultTemplateAgentName = "agent-name"
+
+// newAgentCreateCmd builds the subcommand for downloading a create template
+func newAgentCreateCmd(c *cli) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "create [NAME]",
+		Short: "To download a create template",
+		Long: `
+Save the template of a new agent NAME to NAME.yaml, the file that 'sia agent push NAME -a create' reads:
+     sia agent create support-bot
+     sia agent push support-bot -a create
+Without NAME the template is saved to agent-name.yaml. An existing file is not overwritten.`,
+		Args: cobra.MaximumNArgs(1),
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			c.checkEnvVars()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// Check if access token exists
+			c.checkAccessToken()
+
+			// The template is saved as NAME.yaml, so the name must be valid
+			name := defaultTemplateAgentName
+			if len(args) == 1 {
+				name = args[0]
+			}
+			if err := checkAgentNames([]string{name}); err != nil {
+				c.handleErr(nil, fmt.Sprintf("The name %s may only have letters, digits, hyphens and underscores", name))
+			}
+			fileName := agentYamlFilename(name)
+			if _, err := os.Stat(c.workPath(fileName)); err == nil {
+				c.handleErr(nil, fmt.Sprintf("%s already exists. Give another name or remove the file", fileName))
+			}
+
+			// Step 1: Create the multiline YAML content
+			yamlContent := `
+name: %s # A meaningful name with letters, digits, hyphen, underscore, no blanks
 instructions: |
   This is a sample instruction for the agent. It can be multiline.
   
@@ -43,15 +67,13 @@ new_files:
       split_length: 200 # defaults will be used for missing meta
 `
 
-		// Save the YAML file in the current working directory
-		saveYamlToFile(yamlContent, "create-agent.yaml")
+			// Save the YAML file in the current working directory
+			c.saveYamlToFile(fmt.Sprintf(yamlContent, name), fileName)
 
-		fmt.Printf("Template YAML file for new agent has been downloaded to cwd.\n")
-		fmt.Println()
-	},
-}
+			fmt.Fprintf(c.stdout, "Template YAML file for new agent has been downloaded to %s.\n", fileName)
+			fmt.Fprintln(c.stdout)
+		},
+	}
 
-func init() {
-	// Add the `create` subcommand to `agent` parent command
-	agentCmd.AddCommand(agentCreateCmd)
+	return cmd
 }
@@ -2,44 +2,65 @@ package cmd
 
 import (
 	"fmt"
+	"net/url"
 
 	"github.com/spf13/cobra"
 )
 
-var agentDeleteName string
-
-var agentDeleteCmd = &cobra.Command{
-	Use:     "delete",
-	Aliases: []string{"del"},
-	Short:   "Delete an existing agent",
-	Long: `
-Delete an existing agent`,
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		checkEnvVars()
-	},
-	Run: func(cmd *cobra.Command, args []string) {
-
-		// Check if access token exists
-		checkAccessToken()
-
-		// Construct the delete URL
-		deleteURL := fmt.Sprintf("/api/agents/%s", agentDeleteName)
-
-		// Create Http Request
-		req := createAuthHttpClient("DELETE", deleteURL, nil, "")
-
-		// Execute HTTP client
-		response, responseBody := executeHttpRequest(req)
-		//Check status code
-		checkResponseStatusCode(response, responseBody)
-		// display success
-		fmt.Println("agent successfully deleted")
-	},
-}
+func newAgentDeleteCmd(c *cli) *cobra.Command {
+	var agentDeleteName string
+	var agentDeleteYes bool
+
+	cmd := &cobra.Command{
+		Use:     "delete NAME...",
+		Aliases: []string{"del"},
+		Short:   "Delete existing agents",
+		Long: `
+Delete one or more existing agents, e.g. 'sia agent delete old-bot test-bot'.
+The agents are deleted in order and the command stops at the first that fails.
+
+Each deletion is confirmed by typing the name of the agent, and all of them are confirmed before the
+first agent is deleted. Use --yes to skip the confirmation, which is required when there is no terminal,
+e.g. in scripts.`,
+		Args:              agentNameArgs(-1),
+		ValidArgsFunction: c.completeAgentNameArgs(-1),
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			c.checkEnvVars()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// Check if access token exists
+			c.checkAccessToken()
+
+			// Confirm every agent before anything is deleted
+			names := agentNamesFromArgs(args, agentDeleteName)
+			for _, name := range names {
+				c.confirmByTyping(agentDeleteYes, fmt.Sprintf("delete the agent %s and its files", name), name)
+			}
+
+			for _, name := range names {
+				// Construct the delete URL
+				deleteURL := "/api/agents/" + url.PathEscape(name)
+
+				// Create Http Request
+				req := c.createAuthHttpClient("DELETE", deleteURL, nil, "")
+
+				// Execute HTTP client
+				response, responseBody := c.executeHttpRequest(req)
+				//Check status code
+				c.checkResponseStatusCode(response, responseBody)
+				c.forgetAgentNames()
+				// display success
+				fmt.Fprintf(c.stdout, "agent %s successfully deleted\n", name)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&agentDeleteName, "name", "n", "", "Name of the agent to delete")
+	cmd.Flags().BoolVarP(&agentDeleteYes, "yes", "y", false, "Delete without asking for confirmation")
+	cmd.RegisterFlagCompletionFunc("name", c.completeAgentNames)
 
-func init() {
-	agentDeleteCmd.Flags().StringVarP(&agentDeleteName, "name", "n", "", "Name of the agent to delete")
-	agentDeleteCmd.MarkFlagRequired("name")
+	deprecateNameFlag(cmd, "sia agent delete")
 
-	agentCmd.AddCommand(agentDeleteCmd)
+	return cmd
 }
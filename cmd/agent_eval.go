@@ -0,0 +1,418 @@
+package cmd
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// EvalAssertions are the checks applied to the answer of an eval case
+type EvalAssertions struct {
+	Contains    []string               `yaml:"contains"`
+	NotContains []string               `yaml:"not_contains"`
+	Regex       []string               `yaml:"regex"`
+	MaxLatency  time.Duration          `yaml:"max_latency"`
+	JSONFields  map[string]interface{} `yaml:"json_fields"`
+}
+
+// EvalCase is a single prompt with optional history and its assertions
+type EvalCase struct {
+	Name    string         `yaml:"name"`
+	Prompt  string         `yaml:"prompt"`
+	History []ChatMessage  `yaml:"history"`
+	Assert  EvalAssertions `yaml:"assert"`
+}
+
+type EvalCasesYaml struct {
+	Cases []EvalCase `yaml:"cases"`
+}
+
+// EvalResult is the outcome of running one eval case
+type EvalResult struct {
+	Name     string        `json:"name"`
+	Prompt   string        `json:"prompt"`
+	Passed   bool          `json:"passed"`
+	Latency  time.Duration `json:"-"`
+	Seconds  float64       `json:"latency_seconds"`
+	Answer   string        `json:"answer"`
+	Failures []string      `json:"failures,omitempty"`
+}
+
+type EvalReport struct {
+	Agent   string       `json:"agent"`
+	Total   int          `json:"total"`
+	Passed  int          `json:"passed"`
+	Failed  int          `json:"failed"`
+	Seconds float64      `json:"duration_seconds"`
+	Results []EvalResult `json:"results"`
+}
+
+func newAgentEvalCmd(c *cli) *cobra.Command {
+	var agentEvalName string
+	var agentEvalFilePath string
+	var agentEvalConcurrency int
+	var agentEvalOutput string
+	var agentEvalReport string
+
+	cmd := &cobra.Command{
+		Use:   "eval NAME",
+		Short: "Run a batch of test prompts against an agent",
+		Long: `
+Run a batch of test prompts against an agent and report pass/fail per case.
+
+1. Cases are read from a YAML file with a "cases" list. Each case has a prompt, an optional chat history and assertions:
+   cases:
+     - name: greets
+       prompt: What can you do?
+       history:
+         - role: user
+           content: Hello
+         - role: assistant
+           content: Hi, how can I help?
+       assert:
+         contains: ["documents"]
+         not_contains: ["sorry"]
+         regex: ["(?i)agent"]
+         max_latency: 10s
+         json_fields:   # the answer must be JSON with these exact values
+           status: ok
+           result.count: 3
+2. Reports can be printed as a table, JSON or JUnit XML for CI.
+3. The command exits with a non-zero code if any case fails.`,
+		Args:              agentNameArgs(1),
+		ValidArgsFunction: c.completeAgentNameArgs(1),
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			c.checkEnvVars()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			agentEvalName = agentNamesFromArgs(args, agentEvalName)[0]
+
+			// Validate flags
+			if agentEvalOutput != "table" && agentEvalOutput != "json" && agentEvalOutput != "junit" {
+				c.handleErr(nil, "Output must be one of 'table', 'json' or 'junit'")
+			}
+			if agentEvalConcurrency < 1 {
+				agentEvalConcurrency = 1
+			}
+
+			// Read the cases
+			cases := c.readEvalCasesFile(agentEvalFilePath)
+			if len(cases) == 0 {
+				c.handleErr(nil, fmt.Sprintf("No cases found in %s", agentEvalFilePath))
+			}
+
+			// Run them
+			report := c.runEvalCases(agentEvalName, cases, agentEvalConcurrency)
+			if c.ctx.Err() != nil {
+				c.exitCancelled()
+			}
+
+			// Write the report to stdout or the given file
+			out := io.Writer(c.stdout)
+			var reportFile *os.File
+			if agentEvalReport != "" {
+				var err error
+				reportFile, err = os.Create(c.workPath(agentEvalReport))
+				if err != nil {
+					c.handleErr(err, "Failed to create report file")
+				}
+				out = reportFile
+			}
+			switch agentEvalOutput {
+			case "json":
+				c.writeEvalJSON(out, report)
+			case "junit":
+				c.writeEvalJUnit(out, report)
+			default:
+				writeEvalTable(out, report)
+			}
+			if reportFile != nil {
+				reportFile.Close()
+				fmt.Fprintf(c.stdout, "%d/%d cases passed. Report written to %s\n", report.Passed, report.Total, agentEvalReport)
+			}
+
+			// fail the run so CI picks it up
+			if report.Failed > 0 {
+				c.exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&agentEvalName, "name", "n", "", "Name of the agent to evaluate")
+	cmd.Flags().StringVarP(&agentEvalFilePath, "file", "f", "", "Path to the YAML file with the cases")
+	cmd.Flags().IntVarP(&agentEvalConcurrency, "concurrency", "c", 4, "Number of cases to run in parallel")
+	cmd.Flags().StringVarP(&agentEvalOutput, "output", "o", "table", "Report format: table, json or junit")
+	cmd.Flags().StringVar(&agentEvalReport, "report", "", "Write the report to this file instead of stdout")
+
+	cmd.MarkFlagRequired("file")
+	cmd.RegisterFlagCompletionFunc("name", c.completeAgentNames)
+	cmd.MarkFlagFilename("file", "yaml", "yml")
+	cmd.RegisterFlagCompletionFunc("output", cobra.FixedCompletions([]string{"table", "json", "junit"}, cobra.ShellCompDirectiveNoFileComp))
+
+	deprecateNameFlag(cmd, "sia agent eval")
+
+	return cmd
+}
+
+func (c *cli) readEvalCasesFile(filePath string) []EvalCase {
+	yamlData, err := os.ReadFile(c.workPath(filePath))
+	if err != nil {
+		c.handleErr(err, "Failed to read YAML file")
+	}
+
+	var casesYaml EvalCasesYaml
+	err = yaml.Unmarshal(yamlData, &casesYaml)
+	if err != nil {
+		c.handleErr(err, "Failed to decode YAML data")
+	}
+
+	// name unnamed cases and validate regexes upfront
+	for i := range casesYaml.Cases {
+		if casesYaml.Cases[i].Name == "" {
+			casesYaml.Cases[i].Name = fmt.Sprintf("case-%d", i+1)
+		}
+		if strings.TrimSpace(casesYaml.Cases[i].Prompt) == "" {
+			c.handleErr(nil, fmt.Sprintf("Case %s has no prompt", casesYaml.Cases[i].Name))
+		}
+		for _, pattern := range casesYaml.Cases[i].Assert.Regex {
+			if _, err := regexp.Compile(pattern); err != nil {
+				c.handleErr(err, fmt.Sprintf("Invalid regex in case %s", casesYaml.Cases[i].Name))
+			}
+		}
+	}
+
+	return casesYaml.Cases
+}
+
+// runEvalCases runs the cases with a pool of workers and keeps the results in case order
+func (c *cli) runEvalCases(agentName string, cases []EvalCase, concurrency int) EvalReport {
+	results := make([]EvalResult, len(cases))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+
+	start := time.Now()
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = c.runEvalCase(agentName, cases[i])
+			}
+		}()
+	}
+	for i := range cases {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	report := EvalReport{
+		Agent:   agentName,
+		Total:   len(results),
+		Seconds: time.Since(start).Seconds(),
+		Results: results,
+	}
+	for _, result := range results {
+		if result.Passed {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+	}
+	return report
+}
+
+func (c *cli) runEvalCase(agentName string, evalCase EvalCase) EvalResult {
+	result := EvalResult{Name: evalCase.Name, Prompt: evalCase.Prompt}
+
+	// the chat endpoint expects the current prompt at the end of the messages
+	messages := append([]ChatMessage{}, evalCase.History...)
+	messages = append(messages, ChatMessage{Role: "user", Content: evalCase.Prompt})
+
+	start := time.Now()
+	response, err := c.requestChatPrompt(c.ctx, agentName, evalCase.Prompt, messages)
+	result.Latency = time.Since(start)
+	result.Seconds = result.Latency.Seconds()
+	if err != nil {
+		result.Failures = []string{fmt.Sprintf("request failed: %v", err)}
+		return result
+	}
+
+	result.Answer = response.Content
+	result.Failures = checkEvalAssertions(evalCase.Assert, response.Content, result.Latency)
+	result.Passed = len(result.Failures) == 0
+	return result
+}
+
+// checkEvalAssertions returns a description of every failed assertion
+func checkEvalAssertions(assert EvalAssertions, answer string, latency time.Duration) []string {
+	var failures []string
+
+	for _, text := range assert.Contains {
+		if !strings.Contains(answer, text) {
+			failures = append(failures, fmt.Sprintf("answer does not contain %q", text))
+		}
+	}
+	for _, text := range assert.NotContains {
+		if strings.Contains(answer, text) {
+			failures = append(failures, fmt.Sprintf("answer contains %q", text))
+		}
+	}
+	for _, pattern := range assert.Regex {
+		if !regexp.MustCompile(pattern).MatchString(answer) {
+			failures = append(failures, fmt.Sprintf("answer does not match /%s/", pattern))
+		}
+	}
+	if assert.MaxLatency > 0 && latency > assert.MaxLatency {
+		failures = append(failures, fmt.Sprintf("latency %s exceeds %s", latency.Round(time.Millisecond), assert.MaxLatency))
+	}
+	if len(assert.JSONFields) > 0 {
+		failures = append(failures, checkEvalJSONFields(assert.JSONFields, answer)...)
+	}
+
+	return failures
+}
+
+// checkEvalJSONFields decodes the answer as JSON and compares the fields
+// addressed by dotted paths with the expected values
+func checkEvalJSONFields(fields map[string]interface{}, answer string) []string {
+	var document interface{}
+	if err := json.Unmarshal([]byte(strings.TrimSpace(answer)), &document); err != nil {
+		return []string{"answer is not valid JSON"}
+	}
+
+	// check the fields in order so the failures are the same every run
+	paths := make([]string, 0, len(fields))
+	for path := range fields {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var failures []string
+	for _, path := range paths {
+		expected := fields[path]
+		actual, found := lookupJSONPath(document, path)
+		if !found {
+			failures = append(failures, fmt.Sprintf("JSON field %s is missing", path))
+			continue
+		}
+		// compare through JSON so that YAML ints and JSON floats are equal
+		expectedJSON, _ := json.Marshal(expected)
+		actualJSON, _ := json.Marshal(actual)
+		if string(expectedJSON) != string(actualJSON) {
+			failures = append(failures, fmt.Sprintf("JSON field %s is %s, expected %s", path, actualJSON, expectedJSON))
+		}
+	}
+	return failures
+}
+
+func lookupJSONPath(document interface{}, path string) (interface{}, bool) {
+	current := document
+	for _, key := range strings.Split(path, ".") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = object[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func writeEvalTable(out io.Writer, report EvalReport) {
+	// Print the header row
+	headerFormat := "%-5s %-30s %-6s %-9s %s\n"
+	fmt.Fprintf(out, headerFormat, "SRNO", "CASE", "RESULT", "LATENCY", "DETAILS")
+
+	// Print a separator row for better readability
+	fmt.Fprintln(out, strings.Repeat("-", 67))
+
+	// Print each case
+	rowFormat := "%-5d %-30s %-6s %-9s %s\n"
+	for i, result := range report.Results {
+		status := "PASS"
+		if !result.Passed {
+			status = "FAIL"
+		}
+		latency := fmt.Sprintf("%.2fs", result.Seconds)
+		fmt.Fprintf(out, rowFormat, i+1, result.Name, status, latency, strings.Join(result.Failures, "; "))
+	}
+	fmt.Fprintln(out)
+	fmt.Fprintf(out, "%d passed, %d failed, %d total in %.2fs\n", report.Passed, report.Failed, report.Total, report.Seconds)
+}
+
+func (c *cli) writeEvalJSON(out io.Writer, report EvalReport) {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		c.handleErr(err, "Failed to write JSON report")
+	}
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func (c *cli) writeEvalJUnit(out io.Writer, report EvalReport) {
+	suite := junitTestSuite{
+		Name:     fmt.Sprintf("sia.eval.%s", report.Agent),
+		Tests:    report.Total,
+		Failures: report.Failed,
+		Time:     fmt.Sprintf("%.3f", report.Seconds),
+	}
+	for _, result := range report.Results {
+		testCase := junitTestCase{
+			Name:      result.Name,
+			ClassName: report.Agent,
+			Time:      fmt.Sprintf("%.3f", result.Seconds),
+			SystemOut: result.Answer,
+		}
+		if !result.Passed {
+			testCase.Failure = &junitFailure{
+				Message: result.Failures[0],
+				Text:    strings.Join(result.Failures, "\n"),
+			}
+		}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+
+	xmlData, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		c.handleErr(err, "Failed to write JUnit report")
+	}
+	fmt.Fprintf(out, "%s%s\n", xml.Header, xmlData)
+}
@@ -0,0 +1,239 @@
+package cmd
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"sia-cli/internal/fakeserver"
+)
+
+// TestCheckEvalAssertions checks each kind of assertion on its own and that
+// every failed assertion is reported
+func TestCheckEvalAssertions(t *testing.T) {
+	tests := []struct {
+		name    string
+		assert  EvalAssertions
+		answer  string
+		latency time.Duration
+		want    []string
+	}{
+		{"no assertions", EvalAssertions{}, "anything", time.Second, nil},
+		{"contains", EvalAssertions{Contains: []string{"refund", "30 days"}}, "A refund within 30 days.", 0, nil},
+		{"does not contain", EvalAssertions{Contains: []string{"refund", "30 days"}}, "A refund.", 0, []string{`answer does not contain "30 days"`}},
+		{"not contains", EvalAssertions{NotContains: []string{"sorry"}}, "Yes.", 0, nil},
+		{"contains a forbidden text", EvalAssertions{NotContains: []string{"sorry"}}, "I am sorry.", 0, []string{`answer contains "sorry"`}},
+		{"regex", EvalAssertions{Regex: []string{`^\d+ days$`}}, "30 days", 0, nil},
+		{"regex does not match", EvalAssertions{Regex: []string{`^\d+ days$`}}, "thirty days", 0, []string{`answer does not match /^\d+ days$/`}},
+		{"within max latency", EvalAssertions{MaxLatency: time.Second}, "", time.Second, nil},
+		{"over max latency", EvalAssertions{MaxLatency: time.Second}, "", 1500 * time.Millisecond, []string{"latency 1.5s exceeds 1s"}},
+		{"json fields", EvalAssertions{JSONFields: map[string]interface{}{"ok": true}}, `{"ok": true}`, 0, nil},
+		{"json fields differ", EvalAssertions{JSONFields: map[string]interface{}{"ok": true}}, `{"ok": false}`, 0, []string{"JSON field ok is false, expected true"}},
+		{
+			name:    "all failures",
+			assert:  EvalAssertions{Contains: []string{"yes"}, NotContains: []string{"no"}, Regex: []string{"^y"}, MaxLatency: time.Second, JSONFields: map[string]interface{}{"ok": true}},
+			answer:  "no",
+			latency: 2 * time.Second,
+			want: []string{
+				`answer does not contain "yes"`,
+				`answer contains "no"`,
+				"answer does not match /^y/",
+				"latency 2s exceeds 1s",
+				"answer is not valid JSON",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := checkEvalAssertions(tt.assert, tt.answer, tt.latency)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("checkEvalAssertions = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCheckEvalJSONFields checks fields are looked up by dotted paths and
+// compared as JSON values, with the expected values read from YAML
+func TestCheckEvalJSONFields(t *testing.T) {
+	var assert EvalAssertions
+	cases := `
+json_fields:
+  status: open
+  order.id: 42
+  order.total: 19.5
+  order.items: [a, b]
+  order.paid: null
+`
+	if err := yaml.Unmarshal([]byte(cases), &assert); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		answer string
+		want   []string
+	}{
+		{"all equal", `{"status": "open", "order": {"id": 42, "total": 19.5, "items": ["a", "b"], "paid": null}}`, nil},
+		{"surrounded by spaces", "\n  {\"status\": \"open\", \"order\": {\"id\": 42.0, \"total\": 19.5, \"items\": [\"a\", \"b\"], \"paid\": null}}\n", nil},
+		{
+			name:   "different values",
+			answer: `{"status": "closed", "order": {"id": "42", "total": 19.5, "items": ["b", "a"], "paid": null}}`,
+			want: []string{
+				`JSON field order.id is "42", expected 42`,
+				`JSON field order.items is ["b","a"], expected ["a","b"]`,
+				`JSON field status is "closed", expected "open"`,
+			},
+		},
+		{
+			name:   "missing fields",
+			answer: `{"status": "open", "order": {"id": 42}}`,
+			want: []string{
+				"JSON field order.items is missing",
+				"JSON field order.paid is missing",
+				"JSON field order.total is missing",
+			},
+		},
+		{
+			name:   "not an object on the way",
+			answer: `{"status": "open", "order": [42]}`,
+			want: []string{
+				"JSON field order.id is missing",
+				"JSON field order.items is missing",
+				"JSON field order.paid is missing",
+				"JSON field order.total is missing",
+			},
+		},
+		{"not JSON", "The order is open.", []string{"answer is not valid JSON"}},
+		{"empty answer", "", []string{"answer is not valid JSON"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := checkEvalJSONFields(assert.JSONFields, tt.answer)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("checkEvalJSONFields(%q) = %q, want %q", tt.answer, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestLookupJSONPath checks the lookup of dotted paths
+func TestLookupJSONPath(t *testing.T) {
+	document := map[string]interface{}{
+		"a": map[string]interface{}{"b": map[string]interface{}{"c": "deep"}},
+		"n": nil,
+		"s": "text",
+	}
+	tests := []struct {
+		path      string
+		want      interface{}
+		wantFound bool
+	}{
+		{"a.b.c", "deep", true},
+		{"s", "text", true},
+		{"n", nil, true},
+		{"a.b.x", nil, false},
+		{"s.length", nil, false},
+		{"n.x", nil, false},
+		{"", nil, false},
+	}
+	for _, tt := range tests {
+		got, found := lookupJSONPath(document, tt.path)
+		if found != tt.wantFound || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("lookupJSONPath(%q) = %v, %v, want %v, %v", tt.path, got, found, tt.want, tt.wantFound)
+		}
+	}
+}
+
+// TestAgentEvalExitCode checks the command fails when any case fails and
+// succeeds when all of them pass
+func TestAgentEvalExitCode(t *testing.T) {
+	server := fakeserver.New(fakeserver.Options{
+		APIKey: "test-key",
+		Script: map[string]string{
+			"Refunds?": "Refunds are possible within 30 days.",
+			"Order?":   `{"order": {"id": 42, "status": "open"}}`,
+		},
+	})
+	server.AddAgent(fakeserver.Agent{Name: "kb"})
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	tests := []struct {
+		name       string
+		cases      string
+		wantExit   int
+		wantOutput []string
+	}{
+		{
+			name: "all pass",
+			cases: `cases:
+  - name: refunds
+    prompt: Refunds?
+    assert:
+      contains: [30 days]
+  - name: order
+    prompt: Order?
+    assert:
+      json_fields:
+        order.id: 42
+`,
+			wantExit:   0,
+			wantOutput: []string{"2 passed, 0 failed"},
+		},
+		{
+			name: "one fails",
+			cases: `cases:
+  - name: refunds
+    prompt: Refunds?
+    assert:
+      not_contains: [30 days]
+  - name: order
+    prompt: Order?
+    assert:
+      json_fields:
+        order.status: open
+`,
+			wantExit:   1,
+			wantOutput: []string{"1 passed, 1 failed", `answer contains "30 days"`},
+		},
+		{
+			name: "missing JSON field",
+			cases: `cases:
+  - name: order
+    prompt: Order?
+    assert:
+      json_fields:
+        order.total: 10
+`,
+			wantExit:   1,
+			wantOutput: []string{"0 passed, 1 failed", "JSON field order.total is missing"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			home := t.TempDir()
+			if err := os.WriteFile(filepath.Join(home, "cases.yaml"), []byte(tt.cases), 0600); err != nil {
+				t.Fatal(err)
+			}
+			result := runInProcess(runOptions{
+				args: []string{"agent", "eval", "kb", "-f", "cases.yaml"},
+				env:  map[string]string{"HOME": home, "USERPROFILE": home, "SIA_SERVER_URL": ts.URL, "SIA_API_KEY": "test-key"},
+				dir:  home,
+			})
+			if result.exitCode != tt.wantExit {
+				t.Errorf("exit code = %d, want %d\n%s", result.exitCode, tt.wantExit, result)
+			}
+			for _, want := range tt.wantOutput {
+				if !strings.Contains(result.stdout, want) {
+					t.Errorf("stdout does not contain %q:\n%s", want, result)
+				}
+			}
+		})
+	}
+}
@@ -4,45 +4,51 @@ import (
 	"github.com/spf13/cobra"
 )
 
-// agentListCmd represents the subcommand for listing agents
-var agentListCmd = &cobra.Command{
-	Use:     "list",
-	Aliases: []string{"ls"},
-	Short:   "List all agents",
-	Long:    "List all agents on SIA servers",
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		checkEnvVars()
-	},
-	Run: func(cmd *cobra.Command, args []string) {
+// newAgentListCmd builds the subcommand for listing agents
+func newAgentListCmd(c *cli) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List all agents",
+		Long:    "List all agents on SIA servers",
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			c.checkEnvVars()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
 
-		// Check if access token exists
-		checkAccessToken()
+			// Check if access token exists
+			c.checkAccessToken()
 
-		// Construct the view URL
-		listURL := "/api/agents/"
+			// Construct the view URL
+			listURL := "/api/agents/"
 
-		// Create Http Request
-		req := createAuthHttpClient("GET", listURL, nil, "")
+			// Create Http Request
+			req := c.createAuthHttpClient("GET", listURL, nil, "")
 
-		// Execute HTTP client
-		response, responseBody := executeHttpRequest(req)
+			// Execute HTTP client
+			response, responseBody := c.executeHttpRequest(req)
 
-		//Check status code
-		checkResponseStatusCode(response, responseBody)
+			//Check status code
+			c.checkResponseStatusCode(response, responseBody)
 
-		// Unmarshal response to AgentsListResponse
-		agentsList := unmarshalAgentsListResponse(responseBody)
+			// Unmarshal response to AgentsListResponse
+			agentsList := c.unmarshalAgentsListResponse(responseBody)
 
-		// Convert AgentsListResponse to AgentSummaryDisplay list
-		agentsDisplayList := convertAgentsListToDisplay(agentsList)
+			// Keep the names for shell completion
+			names := make([]string, 0, len(agentsList))
+			for _, agent := range agentsList {
+				names = append(names, agent.Name)
+			}
+			c.saveAgentNames(names)
 
-		// Display the list in a table format
-		displayAgentsTable(agentsDisplayList)
+			// Convert AgentsListResponse to AgentSummaryDisplay list
+			agentsDisplayList := convertAgentsListToDisplay(agentsList)
 
-	},
-}
+			// Display the list in a table format
+			c.displayAgentsTable(agentsDisplayList)
+
+		},
+	}
 
-func init() {
-	// Add the `list` subcommand to `agent` parent command
-	agentCmd.AddCommand(agentListCmd)
+	return cmd
 }
@@ -2,59 +2,75 @@ package cmd
 
 import (
 	"fmt"
+	"net/url"
 
 	"github.com/spf13/cobra"
 )
 
-var agentPullName string
-
-var agentPullCmd = &cobra.Command{
-	Use:   "pull",
-	Short: "Download info of agent in YAML format",
-	Long: `
-Download info of agent in YAML format so that it may be edited and pushed to update the server.`,
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		checkEnvVars()
-	},
-	Run: func(cmd *cobra.Command, args []string) {
-
-		// Check if access token exists
-		checkAccessToken()
-		// Construct the pull URL
-		pullURL := fmt.Sprintf("/api/agents/%s", agentPullName)
-
-		// Create Http Request
-		req := createAuthHttpClient("GET", pullURL, nil, "")
-
-		// Execute HTTP client
-		response, responseBody := executeHttpRequest(req)
-		//Check status code
-		checkResponseStatusCode(response, responseBody)
-		// Unmarshal response to AgentResponse
-		agentResponse := unmarshalAgentResponse(responseBody)
-		// Unmarshal Response to AgentInputYaml
-		agentInput := unmarshalAgentInputYaml(responseBody)
-
-		// Add DeletedFiles from Existing Files
-		addDeletedFiles(&agentInput, agentResponse)
-
-		// Add Sample NewFiles Data
-		addSampleNewFiles(&agentInput)
-
-		// Marshal to YAML with Comments
-		yamlWithComments := addCommentsToYaml(agentInput)
-
-		// Step 6: Save YAML to File
-		filename := fmt.Sprintf("%s.yaml", agentPullName)
-		saveYamlToFile(yamlWithComments, filename)
-
-		fmt.Printf("Agent data has been download as %s in cwd", filename)
-	},
+func newAgentPullCmd(c *cli) *cobra.Command {
+	var agentPullName string
+
+	cmd := &cobra.Command{
+		Use:   "pull NAME...",
+		Short: "Download info of agents in YAML format",
+		Long: `
+Download info of agents in YAML format so that it may be edited and pushed to update the server.
+
+1. Each agent is saved as NAME.yaml in the current directory, e.g. 'sia agent pull support-bot' saves support-bot.yaml.
+2. Push the edited file back with 'sia agent push support-bot -a update', which reads support-bot.yaml.`,
+		Args:              agentNameArgs(-1),
+		ValidArgsFunction: c.completeAgentNameArgs(-1),
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			c.checkEnvVars()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// Check if access token exists
+			c.checkAccessToken()
+
+			for _, name := range agentNamesFromArgs(args, agentPullName) {
+				c.pullAgent(name)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&agentPullName, "name", "n", "", "Name of the agent to pull")
+	cmd.RegisterFlagCompletionFunc("name", c.completeAgentNames)
+
+	deprecateNameFlag(cmd, "sia agent pull")
+
+	return cmd
 }
 
-func init() {
-	agentPullCmd.Flags().StringVarP(&agentPullName, "name", "n", "", "Name of the agent to pull")
-	agentPullCmd.MarkFlagRequired("name")
+// pullAgent saves the agent as NAME.yaml in the current directory
+func (c *cli) pullAgent(name string) {
+	// Construct the pull URL
+	pullURL := "/api/agents/" + url.PathEscape(name)
+
+	// Create Http Request
+	req := c.createAuthHttpClient("GET", pullURL, nil, "")
+
+	// Execute HTTP client
+	response, responseBody := c.executeHttpRequest(req)
+	//Check status code
+	c.checkResponseStatusCode(response, responseBody)
+	// Unmarshal response to AgentResponse
+	agentResponse := c.unmarshalAgentResponse(responseBody)
+	// Unmarshal Response to AgentInputYaml
+	agentInput := c.unmarshalAgentInputYaml(responseBody)
+
+	// Add DeletedFiles from Existing Files
+	addDeletedFiles(&agentInput, agentResponse)
+
+	// Add Sample NewFiles Data
+	addSampleNewFiles(&agentInput)
+
+	// Marshal to YAML with Comments
+	yamlWithComments := c.addCommentsToYaml(agentInput)
+
+	// Step 6: Save YAML to File
+	filename := agentYamlFilename(name)
+	c.saveYamlToFile(yamlWithComments, filename)
 
-	agentCmd.AddCommand(agentPullCmd)
+	fmt.Fprintf(c.stdout, "Agent data has been download as %s in cwd\n", filename)
 }
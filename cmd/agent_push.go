@@ -2,102 +2,169 @@ package cmd
 
 import (
 	"fmt"
+	"net/url"
 	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 )
 
-var agentPushName string
-var agentPushFilePath string
-var agentPushAction string
-
-var agentPushCmd = &cobra.Command{
-	Use:   "push",
-	Short: "Push a new or updated agent info in YAML format to the backend",
-	Long: `
+func newAgentPushCmd(c *cli) *cobra.Command {
+	var agentPushName string
+	var agentPushFilePath string
+	var agentPushAction string
+	var agentPushRmFile bool
+	var agentPushYes bool
+
+	cmd := &cobra.Command{
+		Use:   "push [NAME | FILE]",
+		Short: "Push a new or updated agent info in YAML format to the backend",
+		Long: `
 Push a new or updated agent info in YAML format to the backend. 
 	
 1. Note that the YAML format to "create" a new agent and that of an "update" is same and the PUSH subcommand is used for both.
 2. Hence the need to specify action 
+3. The file is given as FILE or with --file, or as the agent NAME to push NAME.yaml as saved by 'sia agent pull NAME':
+     sia agent push support-bot.yaml -a create
+     sia agent push support-bot -a update
+4. The name of the agent is read from the YAML file.
+5. The file is kept after a successful push. Use --rm-file to delete it.
+6. An update that deletes files listed under deleted_files is confirmed by typing the name of the agent.
+   Use --yes to skip the confirmation, which is required when there is no terminal, e.g. in scripts.
 `,
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		checkEnvVars()
-	},
-	Run: func(cmd *cobra.Command, args []string) {
-
-		// Check if access token exists
-		checkAccessToken()
-
-		// Validate action flag
-		if agentPushAction != "create" && agentPushAction != "update" {
-			fmt.Println("Error: Action must be either 'create' or 'update'.")
-			return
-		}
-
-		// Validate that file exists
-		if _, err := os.Stat(agentPushFilePath); os.IsNotExist(err) {
-			fmt.Printf("Error: File %s not found.\n", agentPushFilePath)
-			return
-		}
-
-		// Step 1: Read YAML file
-		agentInput := readAgentYamlFile(agentPushFilePath)
-
-		// Step 2: Convert AgentInputYaml to AgentPushRequest
-		agentRequest := convertAgentInputToPushRequest(agentInput)
-
-		// Step 3: Create multipart form with files and JSON data
-		requestBody, contentType := createMultipartForm(agentRequest, agentInput)
-
-		// Step 4: Create HTTP client and request
-		var method string
-		var url string
-		if agentPushAction == "create" {
-			method = "POST"
-			url = "/api/agents/"
-		} else {
-			method = "PUT"
-			url = fmt.Sprintf("/api/agents/%s", agentPushName)
-		}
-		req := createAuthHttpClient(method, url, requestBody, contentType)
-
-		// Execute HTTP client
-		response, responseBody := executeHttpRequest(req)
-
-		//Check status code
-		checkResponseStatusCode(response, responseBody)
-
-		// Unmarshal response to AgentResponse
-		agentResponse := unmarshalAgentResponse(responseBody)
-
-		// Convert AgentResponse to AgentDisplay
-		agentDisplay := convertAgentResponseToDisplay(agentResponse)
-
-		// display on terminal
-		fmt.Println("Agent has been updated")
-		fmt.Println("----------------------")
-		// Display the agent details
-		displayAgentDetails(agentDisplay)
-		fmt.Println()
-		err := deleteFile(agentPushFilePath)
-		if err != nil {
-			fmt.Printf("%s could not be deleted", agentPushFilePath)
-		} else {
-			fmt.Printf("%s has been deleted", agentPushFilePath)
-		}
-		fmt.Println()
-
-	},
+		Args:              cobra.MaximumNArgs(1),
+		ValidArgsFunction: completePushArgs,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			c.checkEnvVars()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// Check if access token exists
+			c.checkAccessToken()
+
+			// Validate action flag
+			if agentPushAction != "create" && agentPushAction != "update" {
+				fmt.Fprintln(c.stdout, "Error: Action must be either 'create' or 'update'.")
+				return
+			}
+
+			// Find the file: --file, FILE or NAME.yaml for an agent NAME
+			if len(args) == 1 && agentPushFilePath != "" {
+				c.handleErr(nil, "Give the YAML file as an argument or with --file, not both")
+			}
+			filePath, argName := agentPushFilePath, ""
+			if len(args) == 1 {
+				filePath = args[0]
+				if !isYamlFilename(filePath) {
+					argName = args[0]
+					if err := checkAgentNames([]string{argName}); err != nil {
+						c.handleErr(nil, fmt.Sprintf("%v, or give the YAML file to push", err))
+					}
+					filePath = agentYamlFilename(argName)
+				}
+			}
+			if filePath == "" {
+				c.handleErr(nil, "Give the agent name or the YAML file to push, e.g. 'sia agent push support-bot -a update'")
+			}
+
+			// Validate that file exists
+			if _, err := os.Stat(c.workPath(filePath)); os.IsNotExist(err) {
+				fmt.Fprintf(c.stdout, "Error: File %s not found.\n", filePath)
+				return
+			}
+
+			// Step 1: Read YAML file
+			agentInput := c.readAgentYamlFile(filePath)
+
+			// The name is read from the file, a name given on the command line must match it
+			agentName := agentInput.Name
+			if agentName == "" {
+				c.handleErr(nil, fmt.Sprintf("%s has no name", filePath))
+			}
+			for _, given := range []string{argName, agentPushName} {
+				if given != "" && given != agentName {
+					c.handleErr(nil, fmt.Sprintf("The name %s does not match the name %s in %s", given, agentName, filePath))
+				}
+			}
+
+			// Files deleted by an update cannot be restored
+			if agentPushAction == "update" && len(agentInput.DeletedFiles) > 0 {
+				action := fmt.Sprintf("delete %s from the agent %s", strings.Join(agentInput.DeletedFiles, ", "), agentName)
+				c.confirmByTyping(agentPushYes, action, agentName)
+			}
+
+			// Step 2: Convert AgentInputYaml to AgentPushRequest
+			agentRequest := convertAgentInputToPushRequest(agentInput)
+
+			// Step 3: Create multipart form with files and JSON data
+			requestBody, contentType := c.createMultipartForm(agentRequest, agentInput)
+
+			// Step 4: Create HTTP client and request
+			var method string
+			var pushURL string
+			if agentPushAction == "create" {
+				method = "POST"
+				pushURL = "/api/agents/"
+			} else {
+				method = "PUT"
+				pushURL = "/api/agents/" + url.PathEscape(agentName)
+			}
+			req := c.createAuthHttpClient(method, pushURL, requestBody, contentType)
+
+			// Execute HTTP client
+			response, responseBody := c.executeHttpRequest(req)
+
+			//Check status code
+			c.checkResponseStatusCode(response, responseBody)
+			if agentPushAction == "create" {
+				c.forgetAgentNames()
+			}
+
+			// Unmarshal response to AgentResponse
+			agentResponse := c.unmarshalAgentResponse(responseBody)
+
+			// Convert AgentResponse to AgentDisplay
+			agentDisplay := convertAgentResponseToDisplay(agentResponse)
+
+			// display on terminal
+			fmt.Fprintln(c.stdout, "Agent has been updated")
+			fmt.Fprintln(c.stdout, "----------------------")
+			// Display the agent details
+			c.displayAgentDetails(agentDisplay)
+			if agentPushRmFile {
+				fmt.Fprintln(c.stdout)
+				err := deleteFile(c.workPath(filePath))
+				if err != nil {
+					fmt.Fprintf(c.stdout, "%s could not be deleted", filePath)
+				} else {
+					fmt.Fprintf(c.stdout, "%s has been deleted", filePath)
+				}
+				fmt.Fprintln(c.stdout)
+			}
+
+		},
+	}
+
+	cmd.Flags().StringVarP(&agentPushName, "name", "n", "", "Name of the agent, which must match the name in the YAML file")
+	cmd.Flags().StringVarP(&agentPushFilePath, "file", "f", "", "Path to the YAML file")
+	cmd.Flags().StringVarP(&agentPushAction, "action", "a", "", "Action to perform: create or update")
+	cmd.Flags().BoolVar(&agentPushRmFile, "rm-file", false, "Delete the YAML file after a successful push")
+	cmd.Flags().BoolVarP(&agentPushYes, "yes", "y", false, "Delete the files under deleted_files without asking for confirmation")
+
+	cmd.MarkFlagRequired("action")
+	cmd.RegisterFlagCompletionFunc("name", c.completeAgentNames)
+	cmd.MarkFlagFilename("file", "yaml", "yml")
+	cmd.RegisterFlagCompletionFunc("action", cobra.FixedCompletions([]string{"create", "update"}, cobra.ShellCompDirectiveNoFileComp))
+
+	cmd.Flags().MarkDeprecated("name", "the name is read from the YAML file")
+
+	return cmd
 }
 
-func init() {
-	agentPushCmd.Flags().StringVarP(&agentPushName, "name", "n", "", "Name of the agent")
-	agentPushCmd.Flags().StringVarP(&agentPushFilePath, "file", "f", "", "Path to the YAML file")
-	agentPushCmd.Flags().StringVarP(&agentPushAction, "action", "a", "", "Action to perform: create or update")
-
-	agentPushCmd.MarkFlagRequired("name")
-	agentPushCmd.MarkFlagRequired("file")
-	agentPushCmd.MarkFlagRequired("action")
-
-	agentCmd.AddCommand(agentPushCmd)
+// completePushArgs completes the YAML file to push
+func completePushArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return []string{"yaml", "yml"}, cobra.ShellCompDirectiveFilterFileExt
 }
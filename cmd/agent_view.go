@@ -2,50 +2,60 @@ package cmd
 
 import (
 	"fmt"
+	"net/url"
 
 	"github.com/spf13/cobra"
 )
 
-var agentViewName string
-
-var agentViewCmd = &cobra.Command{
-	Use:     "view",
-	Aliases: []string{"vi"},
-	Short:   "View information about an agent",
-	Long: `
-View information about an agent`,
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		checkEnvVars()
-	},
-	Run: func(cmd *cobra.Command, args []string) {
-
-		// Check if access token exists
-		checkAccessToken()
-
-		// Construct the view URL
-		viewURL := fmt.Sprintf("/api/agents/%s", agentViewName)
-
-		// Create Http Request
-		req := createAuthHttpClient("GET", viewURL, nil, "")
-
-		// Execute HTTP client
-		response, responseBody := executeHttpRequest(req)
-		//Check status code
-		checkResponseStatusCode(response, responseBody)
-		// Unmarshal response to AgentResponse
-		agentResponse := unmarshalAgentResponse(responseBody)
-		// Convert AgentResponse to AgentDisplay
-		agentDisplay := convertAgentResponseToDisplay(agentResponse)
-
-		// Display the agent details
-		displayAgentDetails(agentDisplay)
-
-	},
-}
-
-func init() {
-	agentViewCmd.Flags().StringVarP(&agentViewName, "name", "n", "", "Name of the agent to view")
-	agentViewCmd.MarkFlagRequired("name")
-
-	agentCmd.AddCommand(agentViewCmd)
+func newAgentViewCmd(c *cli) *cobra.Command {
+	var agentViewName string
+
+	cmd := &cobra.Command{
+		Use:     "view NAME...",
+		Aliases: []string{"vi"},
+		Short:   "View information about agents",
+		Long: `
+View information about one or more agents, e.g. 'sia agent view support-bot sales-bot'.
+The agents are printed as YAML documents separated by ---.`,
+		Args:              agentNameArgs(-1),
+		ValidArgsFunction: c.completeAgentNameArgs(-1),
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			c.checkEnvVars()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// Check if access token exists
+			c.checkAccessToken()
+
+			for i, name := range agentNamesFromArgs(args, agentViewName) {
+				// Construct the view URL
+				viewURL := "/api/agents/" + url.PathEscape(name)
+
+				// Create Http Request
+				req := c.createAuthHttpClient("GET", viewURL, nil, "")
+
+				// Execute HTTP client
+				response, responseBody := c.executeHttpRequest(req)
+				//Check status code
+				c.checkResponseStatusCode(response, responseBody)
+				// Unmarshal response to AgentResponse
+				agentResponse := c.unmarshalAgentResponse(responseBody)
+				// Convert AgentResponse to AgentDisplay
+				agentDisplay := convertAgentResponseToDisplay(agentResponse)
+
+				// Display the agent details
+				if i > 0 {
+					fmt.Fprintln(c.stdout, "---")
+				}
+				c.displayAgentDetails(agentDisplay)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&agentViewName, "name", "n", "", "Name of the agent to view")
+	cmd.RegisterFlagCompletionFunc("name", c.completeAgentNames)
+
+	deprecateNameFlag(cmd, "sia agent view")
+
+	return cmd
 }
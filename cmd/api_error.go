@@ -0,0 +1,227 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// errorSnippetLimit is how much of a body that is not a JSON error is shown
+const errorSnippetLimit = 200
+
+// APIError is an error response of the SIA server, or of a proxy in front of it
+type APIError struct {
+	StatusCode  int
+	Code        string
+	Message     string
+	FieldErrors []FieldError
+	RequestID   string
+
+	// Path of the request, to tell login failures from expired sessions
+	Path string
+}
+
+// FieldError is a validation error of one field of the request
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// Error returns the message on one line, as shown in reports and by servers
+func (e *APIError) Error() string {
+	message := e.Message
+	if len(e.FieldErrors) > 0 {
+		fields := make([]string, len(e.FieldErrors))
+		for i, fieldError := range e.FieldErrors {
+			fields[i] = fieldError.String()
+		}
+		message += ": " + strings.Join(fields, "; ")
+	}
+	if e.RequestID != "" {
+		message += fmt.Sprintf(" (request id %s)", e.RequestID)
+	}
+	return message
+}
+
+// Describe returns the message with one line per field error, the request id
+// and a hint on what to do next
+func (e *APIError) Describe() string {
+	var b strings.Builder
+	b.WriteString(e.Message)
+	for _, fieldError := range e.FieldErrors {
+		b.WriteString("\n  - " + fieldError.String())
+	}
+	if e.RequestID != "" {
+		b.WriteString("\nRequest ID: " + e.RequestID)
+	}
+	if hint := e.Hint(); hint != "" {
+		b.WriteString("\n" + hint)
+	}
+	return b.String()
+}
+
+// Hint suggests how to fix errors the user can do something about
+func (e *APIError) Hint() string {
+	switch e.StatusCode {
+	case http.StatusUnauthorized:
+		// a wrong password at login is not an expired session
+		if strings.HasPrefix(e.Path, "/api/auth/") {
+			return ""
+		}
+		return "Your session has expired or you are not logged in. Run 'sia login' and try again."
+	case http.StatusForbidden:
+		return "Check that SIA_API_KEY is the API key of this server."
+	}
+	return ""
+}
+
+func (f FieldError) String() string {
+	if f.Field == "" {
+		return f.Message
+	}
+	return f.Field + ": " + f.Message
+}
+
+// newAPIError decodes an error response. The body may be a {"detail": ...}
+// JSON object where detail is a string, a list of validation errors or an
+// object, or anything else such as an HTML page from a proxy or nothing at all
+func newAPIError(res *http.Response, body []byte) *APIError {
+	apiError := &APIError{
+		StatusCode: res.StatusCode,
+		RequestID:  requestIDHeader(res.Header),
+	}
+	if res.Request != nil {
+		apiError.Path = res.Request.URL.Path
+	}
+
+	var errorBody map[string]json.RawMessage
+	if err := json.Unmarshal(body, &errorBody); err == nil {
+		decodeErrorFields(apiError, errorBody)
+		if detail, ok := errorBody["detail"]; ok {
+			decodeErrorDetail(apiError, detail)
+		}
+	}
+
+	// fall back to the status and the start of the body
+	if apiError.Message == "" {
+		apiError.Message = statusText(res)
+		if snippet := bodySnippet(body); snippet != "" {
+			apiError.Message += ": " + snippet
+		}
+	}
+	return apiError
+}
+
+// decodeErrorFields reads the message, code and request id of an error object
+func decodeErrorFields(apiError *APIError, fields map[string]json.RawMessage) {
+	var text string
+	for _, key := range []string{"message", "msg", "error"} {
+		if json.Unmarshal(fields[key], &text) == nil && text != "" && apiError.Message == "" {
+			apiError.Message = text
+		}
+	}
+	for _, key := range []string{"code", "type", "error_code"} {
+		if json.Unmarshal(fields[key], &text) == nil && text != "" && apiError.Code == "" {
+			apiError.Code = text
+		}
+	}
+	if json.Unmarshal(fields["request_id"], &text) == nil && text != "" && apiError.RequestID == "" {
+		apiError.RequestID = text
+	}
+}
+
+// decodeErrorDetail reads the FastAPI detail, which is a string for errors
+// raised by the server and a list of field errors for invalid requests
+func decodeErrorDetail(apiError *APIError, detail json.RawMessage) {
+	var text string
+	if err := json.Unmarshal(detail, &text); err == nil {
+		if text != "" {
+			apiError.Message = text
+		}
+		return
+	}
+
+	var validationErrors []struct {
+		Loc  []interface{} `json:"loc"`
+		Msg  string        `json:"msg"`
+		Type string        `json:"type"`
+	}
+	if err := json.Unmarshal(detail, &validationErrors); err == nil {
+		for _, validationError := range validationErrors {
+			apiError.FieldErrors = append(apiError.FieldErrors, FieldError{
+				Field:   fieldPath(validationError.Loc),
+				Message: validationError.Msg,
+			})
+			if apiError.Code == "" {
+				apiError.Code = validationError.Type
+			}
+		}
+		if apiError.Message == "" {
+			apiError.Message = "The request is invalid"
+		}
+		return
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(detail, &fields); err == nil {
+		var nested APIError
+		decodeErrorFields(&nested, fields)
+		if nested.Message != "" {
+			apiError.Message = nested.Message
+		}
+		if nested.Code != "" {
+			apiError.Code = nested.Code
+		}
+		if nested.RequestID != "" {
+			apiError.RequestID = nested.RequestID
+		}
+	}
+}
+
+// fieldPath joins the location of a validation error, leaving out where in
+// the request it is, e.g. ["body", "files", 0, "filename"] is files.0.filename
+func fieldPath(loc []interface{}) string {
+	var parts []string
+	for i, part := range loc {
+		text := fmt.Sprint(part)
+		if i == 0 && (text == "body" || text == "query" || text == "path" || text == "header" || text == "cookie") {
+			continue
+		}
+		parts = append(parts, text)
+	}
+	return strings.Join(parts, ".")
+}
+
+func requestIDHeader(header http.Header) string {
+	for _, name := range []string{"X-Request-Id", "X-Correlation-Id", "X-Amzn-Trace-Id", "Cf-Ray"} {
+		if value := header.Get(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func statusText(res *http.Response) string {
+	if text := http.StatusText(res.StatusCode); text != "" {
+		return fmt.Sprintf("Server returned %d %s", res.StatusCode, text)
+	}
+	return fmt.Sprintf("Server returned %s", res.Status)
+}
+
+var htmlTagPattern = regexp.MustCompile(`(?is)<head.*?</head>|<script.*?</script>|<style.*?</style>|<[^>]*>`)
+
+// bodySnippet returns the start of a body as one line of text, without the
+// tags of an HTML page
+func bodySnippet(body []byte) string {
+	text := string(body)
+	if strings.Contains(text, "<") {
+		text = htmlTagPattern.ReplaceAllString(text, " ")
+	}
+	text = strings.Join(strings.Fields(text), " ")
+	if len([]rune(text)) > errorSnippetLimit {
+		text = string([]rune(text)[:errorSnippetLimit]) + "..."
+	}
+	return text
+}
@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestNewAPIError checks each layout of error body the server or a proxy
+// in front of it may answer with
+func TestNewAPIError(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		header http.Header
+		body   string
+		want   APIError
+	}{
+		{
+			name:   "string detail",
+			status: http.StatusNotFound,
+			body:   `{"detail": "Agent not found"}`,
+			want:   APIError{Message: "Agent not found"},
+		},
+		{
+			name:   "list detail",
+			status: http.StatusUnprocessableEntity,
+			body:   `{"detail": [{"loc": ["body", "files", 0, "filename"], "msg": "Field required", "type": "missing"}, {"loc": ["body", "name"], "msg": "Too long", "type": "string_too_long"}]}`,
+			want: APIError{
+				Code:    "missing",
+				Message: "The request is invalid",
+				FieldErrors: []FieldError{
+					{Field: "files.0.filename", Message: "Field required"},
+					{Field: "name", Message: "Too long"},
+				},
+			},
+		},
+		{
+			name:   "object detail",
+			status: http.StatusConflict,
+			body:   `{"detail": {"message": "Agent exists", "code": "agent_exists", "request_id": "req-1"}}`,
+			want:   APIError{Code: "agent_exists", Message: "Agent exists", RequestID: "req-1"},
+		},
+		{
+			name:   "error object without detail",
+			status: http.StatusInternalServerError,
+			body:   `{"error": "Database is down", "type": "db_error"}`,
+			want:   APIError{Code: "db_error", Message: "Database is down"},
+		},
+		{
+			name:   "request id header",
+			status: http.StatusInternalServerError,
+			header: http.Header{"X-Request-Id": {"req-2"}},
+			body:   `{"detail": "Internal error"}`,
+			want:   APIError{Message: "Internal error", RequestID: "req-2"},
+		},
+		{
+			name:   "HTML page of a proxy",
+			status: http.StatusBadGateway,
+			body:   "<html><head><title>502</title><style>h1 {}</style></head><body><h1>Bad Gateway</h1>\n<p>nginx</p></body></html>",
+			want:   APIError{Message: "Server returned 502 Bad Gateway: Bad Gateway nginx"},
+		},
+		{
+			name:   "empty body",
+			status: http.StatusServiceUnavailable,
+			want:   APIError{Message: "Server returned 503 Service Unavailable"},
+		},
+		{
+			name:   "empty detail",
+			status: http.StatusBadRequest,
+			body:   `{"detail": ""}`,
+			want:   APIError{Message: `Server returned 400 Bad Request: {"detail": ""}`},
+		},
+		{
+			name:   "long text",
+			status: http.StatusInternalServerError,
+			body:   strings.Repeat("x", errorSnippetLimit+10),
+			want:   APIError{Message: "Server returned 500 Internal Server Error: " + strings.Repeat("x", errorSnippetLimit) + "..."},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := &http.Response{
+				StatusCode: tt.status,
+				Header:     tt.header,
+				Request:    &http.Request{URL: &url.URL{Path: "/api/agents/kb"}},
+			}
+			if res.Header == nil {
+				res.Header = http.Header{}
+			}
+			got := newAPIError(res, []byte(tt.body))
+			tt.want.StatusCode = tt.status
+			tt.want.Path = "/api/agents/kb"
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("newAPIError =\n%#v\nwant\n%#v", *got, tt.want)
+			}
+		})
+	}
+}
+
+// TestAPIErrorHint checks the hints for a missing login and a wrong API key,
+// and that a failed login is not taken for an expired session
+func TestAPIErrorHint(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		path   string
+		want   string
+	}{
+		{"expired session", http.StatusUnauthorized, "/api/agents/", "Run 'sia login'"},
+		{"wrong password", http.StatusUnauthorized, "/api/auth/login", ""},
+		{"wrong API key", http.StatusForbidden, "/api/agents/", "SIA_API_KEY"},
+		{"not found", http.StatusNotFound, "/api/agents/kb", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hint := (&APIError{StatusCode: tt.status, Path: tt.path}).Hint()
+			if tt.want == "" && hint != "" || !strings.Contains(hint, tt.want) {
+				t.Errorf("Hint() = %q, want %q", hint, tt.want)
+			}
+		})
+	}
+}
+
+// TestAPIErrorDescribe checks the layout of the message shown to the user
+func TestAPIErrorDescribe(t *testing.T) {
+	apiError := &APIError{
+		StatusCode:  http.StatusUnauthorized,
+		Message:     "Not authenticated",
+		FieldErrors: []FieldError{{Field: "name", Message: "Too long"}, {Message: "Missing files"}},
+		RequestID:   "req-3",
+		Path:        "/api/agents/",
+	}
+	want := "Not authenticated\n  - name: Too long\n  - Missing files\nRequest ID: req-3\n" +
+		"Your session has expired or you are not logged in. Run 'sia login' and try again."
+	if got := apiError.Describe(); got != want {
+		t.Errorf("Describe() =\n%s\nwant\n%s", got, want)
+	}
+	if got, want := apiError.Error(), "Not authenticated: name: Too long; Missing files (request id req-3)"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// newAuthCmd builds the auth parent command
+func newAuthCmd(c *cli) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "auth",
+		Short: "Manage the login to SIA servers",
+		Long: `
+Manage the login to SIA servers with subcommands like status.`,
+
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			c.checkEnvVars()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+
+	cmd.AddCommand(
+		newAuthStatusCmd(c),
+		newAuthMigrateCmd(c),
+	)
+	return cmd
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// newAuthMigrateCmd builds the auth migrate command
+func newAuthMigrateCmd(c *cli) *cobra.Command {
+	var migrateFrom string
+	var migrateTo string
+	var migrateAPIKey bool
+
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Move the saved credentials into another credential store",
+		Long: `
+Move the saved credentials, such as the access token in ~/.sia/.access_token, into another credential store.
+
+1. The stores are plaintext (files in ~/.sia), keyring (the keyring of the OS) and encrypted-file
+   (~/.sia/credentials.enc, protected by a passphrase or SIA_CREDENTIALS_PASSPHRASE).
+2. By default the credentials move from plaintext to the credential_store of the profile.
+3. Use --api-key to also save $SIA_API_KEY, which is then used when SIA_API_KEY is not set.
+4. Set credential_store in ~/.sia/config.yaml afterwards so that sia reads the credentials from the new store.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			to := migrateTo
+			if to == "" {
+				to = c.profile.CredentialStore
+			}
+			if to == migrateFrom {
+				c.handleErr(nil, fmt.Sprintf("The credentials are already in %s. Choose another store with --to", to))
+			}
+
+			source, err := c.openCredentialStore(migrateFrom)
+			if err != nil {
+				c.handleErr(err, "Failed to open the credential store")
+			}
+			target, err := c.openCredentialStore(to)
+			if err != nil {
+				c.handleErr(err, "Failed to open the credential store")
+			}
+
+			// copy everything first so nothing is lost when the target fails
+			var moved []string
+			for _, key := range []string{credentialAccessToken, credentialTokenServer, credentialAPIKey} {
+				value, err := source.Get(key)
+				if errors.Is(err, errCredentialNotFound) {
+					continue
+				}
+				if err != nil {
+					c.handleErr(err, fmt.Sprintf("Failed to read %s from %s", key, source.Name()))
+				}
+				if err := target.Set(key, value); err != nil {
+					c.handleErr(err, fmt.Sprintf("Failed to save %s in %s", key, target.Name()))
+				}
+				moved = append(moved, key)
+			}
+			if migrateAPIKey {
+				apiKey := c.getenv("SIA_API_KEY")
+				if apiKey == "" {
+					c.handleErr(nil, "--api-key needs SIA_API_KEY to be set")
+				}
+				if err := target.Set(credentialAPIKey, apiKey); err != nil {
+					c.handleErr(err, fmt.Sprintf("Failed to save the API key in %s", target.Name()))
+				}
+				fmt.Fprintf(c.stdout, "Saved SIA_API_KEY in %s.\n", target.Name())
+			}
+
+			// then remove them from the old store
+			for _, key := range moved {
+				if err := source.Delete(key); err != nil {
+					c.handleErr(err, fmt.Sprintf("Failed to delete %s from %s", key, source.Name()))
+				}
+				fmt.Fprintf(c.stdout, "Moved %s from %s to %s.\n", key, source.Name(), target.Name())
+			}
+			if len(moved) == 0 && !migrateAPIKey {
+				fmt.Fprintf(c.stdout, "There are no credentials in %s to migrate.\n", source.Name())
+			}
+
+			if c.profile.CredentialStore != to {
+				fmt.Fprintln(c.stdout)
+				fmt.Fprintf(c.stdout, "Set credential_store: %s in the %s profile of ~/.sia/config.yaml to use them.\n", to, c.profileName)
+			}
+			fmt.Fprintln(c.stdout)
+		},
+	}
+
+	cmd.Flags().StringVar(&migrateFrom, "from", CredentialStorePlaintext, "Store to move the credentials from")
+	cmd.Flags().StringVar(&migrateTo, "to", "", "Store to move the credentials to (default the credential_store of the profile)")
+	cmd.Flags().BoolVar(&migrateAPIKey, "api-key", false, "Also save $SIA_API_KEY in the store")
+
+	return cmd
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// newAuthStatusCmd builds the auth status command
+func newAuthStatusCmd(c *cli) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the server you are logged into and when the login expires",
+		Long: `
+Show the server you are logged into and when the login expires.
+
+1. The expiry is read from the access token when it is a JWT. The server may still end the session earlier.
+2. Exits with code 3 when you are not logged in or the token has expired.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			serverURL := c.getenv("SIA_SERVER_URL")
+
+			// Check if access token exists
+			accessToken, err := c.readAccessToken()
+			if err != nil && !errors.Is(err, errCredentialNotFound) {
+				c.handleErr(err, "Failed to read the access token")
+			}
+			if err != nil || accessToken == "" {
+				fmt.Fprintf(c.stdout, "Server     : %s\n", serverURL)
+				c.handleAuthErr("Not logged in. Use 'sia login'")
+			}
+
+			// the token may be for another server than the current one
+			tokenServer := c.readAccessTokenServer()
+			mismatch := tokenServer != "" && tokenServer != serverURL
+			if tokenServer == "" {
+				tokenServer = "unknown (logged in with an older version of sia)"
+			}
+			fmt.Fprintf(c.stdout, "Server     : %s\n", serverURL)
+			fmt.Fprintf(c.stdout, "Logged into: %s\n", tokenServer)
+			fmt.Fprintf(c.stdout, "Stored in  : %s\n", c.profile.CredentialStore)
+			if mismatch {
+				fmt.Fprintln(c.stdout, "Warning: SIA_SERVER_URL is not the server you logged into. Use 'sia login' to log into it.")
+			}
+
+			claims, err := decodeTokenClaims(accessToken)
+			if err != nil {
+				fmt.Fprintf(c.stdout, "Expires    : unknown, %v\n", err)
+				fmt.Fprintln(c.stdout)
+				return
+			}
+			if claims.Subject != "" {
+				fmt.Fprintf(c.stdout, "User       : %s\n", claims.Subject)
+			}
+			if claims.IssuedAt > 0 {
+				fmt.Fprintf(c.stdout, "Issued     : %s\n", time.Unix(claims.IssuedAt, 0).Local().Format("2006-01-02 15:04:05 MST"))
+			}
+			if claims.ExpiresAt == 0 {
+				fmt.Fprintln(c.stdout, "Expires    : never")
+				fmt.Fprintln(c.stdout)
+				return
+			}
+			expiresAt := time.Unix(claims.ExpiresAt, 0)
+			fmt.Fprintf(c.stdout, "Expires    : %s\n", describeExpiry(expiresAt, time.Now()))
+			fmt.Fprintln(c.stdout)
+			if !expiresAt.After(time.Now()) {
+				c.handleAuthErr("The login has expired. Use 'sia login'")
+			}
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestAuthStatusWarnsAboutOtherServer checks the warning is shown when the
+// token is for another server, also when its expiry cannot be read
+func TestAuthStatusWarnsAboutOtherServer(t *testing.T) {
+	home := t.TempDir()
+	siaDir := filepath.Join(home, TokenDir)
+	if err := os.Mkdir(siaDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(siaDir, TokenFilename), []byte("not-a-jwt"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(siaDir, TokenServerFilename), []byte("https://other.example.com"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	result := runInProcess(runOptions{
+		args: []string{"auth", "status"},
+		env:  map[string]string{"HOME": home, "USERPROFILE": home, "SIA_SERVER_URL": "https://sia.example.com", "SIA_API_KEY": "key"},
+	})
+
+	if result.exitCode != 0 {
+		t.Errorf("exit code = %d, want 0\n%s", result.exitCode, result)
+	}
+	if !strings.Contains(result.stdout, "Expires    : unknown") {
+		t.Errorf("stdout does not say the expiry is unknown:\n%s", result)
+	}
+	if !strings.Contains(result.stdout, "Warning: SIA_SERVER_URL is not the server you logged into") {
+		t.Errorf("stdout has no warning about the other server:\n%s", result)
+	}
+}
@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// newBenchCmd builds the bench parent command
+func newBenchCmd(c *cli) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bench",
+		Short: "Benchmark a SIA server",
+		Long: `
+Benchmark a SIA server with subcommands like chat, to help size servers before a rollout.`,
+
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			c.checkEnvVars()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+
+	cmd.AddCommand(
+		newBenchChatCmd(c),
+	)
+	return cmd
+}
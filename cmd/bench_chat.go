@@ -0,0 +1,342 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// BenchLatencies holds latency percentiles in milliseconds
+type BenchLatencies struct {
+	Min  float64 `json:"min_ms"`
+	Mean float64 `json:"mean_ms"`
+	P50  float64 `json:"p50_ms"`
+	P90  float64 `json:"p90_ms"`
+	P99  float64 `json:"p99_ms"`
+	Max  float64 `json:"max_ms"`
+}
+
+// BenchHistogramRow is one line of the percentile distribution
+type BenchHistogramRow struct {
+	ValueMs    float64 `json:"value_ms"`
+	Percentile float64 `json:"percentile"`
+	TotalCount int     `json:"total_count"`
+}
+
+// BenchReport is the outcome of a benchmark run
+type BenchReport struct {
+	Agent       string              `json:"agent"`
+	Concurrency int                 `json:"concurrency"`
+	Seconds     float64             `json:"duration_seconds"`
+	Requests    int                 `json:"requests"`
+	Succeeded   int                 `json:"succeeded"`
+	Failed      int                 `json:"failed"`
+	Throughput  float64             `json:"requests_per_second"`
+	ErrorRate   float64             `json:"error_rate"`
+	StatusCodes map[string]int      `json:"status_codes"`
+	Latency     BenchLatencies      `json:"latency"`
+	Histogram   []BenchHistogramRow `json:"histogram,omitempty"`
+}
+
+// benchRequestError is the status of requests that could not be built, which
+// were never sent and so have no latency
+const benchRequestError = "request error"
+
+// benchSample is the result of a single request
+type benchSample struct {
+	status  string
+	latency time.Duration
+}
+
+func newBenchChatCmd(c *cli) *cobra.Command {
+	var benchChatName string
+	var benchChatConcurrency int
+	var benchChatDuration time.Duration
+	var benchChatPromptsPath string
+	var benchChatHistogram bool
+	var benchChatOutput string
+
+	cmd := &cobra.Command{
+		Use:   "chat NAME",
+		Short: "Load test the chat endpoint of an agent",
+		Long: `
+Load test the chat endpoint of an agent.
+
+1. A pool of workers sends the prompts from the prompts file (one per line) round robin for the given duration.
+2. Throughput, errors by status code and latency percentiles (p50/p90/p99) are reported at the end.
+3. Use --histogram for the full percentile distribution and -o json for machine readable output.`,
+		Args:              agentNameArgs(1),
+		ValidArgsFunction: c.completeAgentNameArgs(1),
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			c.checkEnvVars()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			benchChatName = agentNamesFromArgs(args, benchChatName)[0]
+
+			// Validate flags
+			if benchChatOutput != "table" && benchChatOutput != "json" {
+				c.handleErr(nil, "Output must be either 'table' or 'json'")
+			}
+			if benchChatConcurrency < 1 {
+				c.handleErr(nil, "Concurrency must be at least 1")
+			}
+			if benchChatDuration <= 0 {
+				c.handleErr(nil, "Duration must be greater than zero")
+			}
+
+			// Read the prompts
+			prompts := c.readPromptsFile(benchChatPromptsPath)
+			if len(prompts) == 0 {
+				c.handleErr(nil, fmt.Sprintf("No prompts found in %s", benchChatPromptsPath))
+			}
+
+			// one client sized for the worker pool, shared by all workers, and no
+			// retries so that every failure is counted
+			c.httpClient = c.newHttpClient(benchChatConcurrency)
+			c.profile.Retries = 0
+
+			if benchChatOutput == "table" {
+				fmt.Fprintf(c.stdout, "Benchmarking %s with %d workers for %s...\n\n", benchChatName, benchChatConcurrency, benchChatDuration)
+			}
+			samples, elapsed := c.runChatBench(benchChatName, prompts, benchChatConcurrency, benchChatDuration)
+			report := buildBenchReport(benchChatName, benchChatConcurrency, samples, elapsed, benchChatHistogram)
+			cancelled := c.ctx.Err() != nil
+			if cancelled && benchChatOutput == "table" {
+				fmt.Fprintf(c.stdout, "Cancelled after %.1fs, showing partial results.\n\n", elapsed.Seconds())
+			}
+
+			if benchChatOutput == "json" {
+				encoder := json.NewEncoder(c.stdout)
+				encoder.SetIndent("", "  ")
+				if err := encoder.Encode(report); err != nil {
+					c.handleErr(err, "Failed to write JSON report")
+				}
+			} else {
+				displayBenchReport(c.stdout, report)
+			}
+			if cancelled {
+				c.exit(ExitCancelled)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&benchChatName, "name", "n", "", "Name of the agent to benchmark")
+	cmd.Flags().IntVarP(&benchChatConcurrency, "concurrency", "c", 10, "Number of concurrent workers")
+	cmd.Flags().DurationVarP(&benchChatDuration, "duration", "d", 30*time.Second, "How long to run the benchmark")
+	cmd.Flags().StringVarP(&benchChatPromptsPath, "prompts", "p", "", "Path to a text file with one prompt per line")
+	cmd.Flags().BoolVar(&benchChatHistogram, "histogram", false, "Show the full latency percentile distribution")
+	cmd.Flags().StringVarP(&benchChatOutput, "output", "o", "table", "Output format: table or json")
+	cmd.RegisterFlagCompletionFunc("output", cobra.FixedCompletions([]string{"table", "json"}, cobra.ShellCompDirectiveNoFileComp))
+
+	cmd.MarkFlagRequired("prompts")
+	cmd.RegisterFlagCompletionFunc("name", c.completeAgentNames)
+
+	deprecateNameFlag(cmd, "sia bench chat")
+
+	return cmd
+}
+
+// runChatBench drives the chat endpoint until the duration has passed
+func (c *cli) runChatBench(agentName string, prompts []string, concurrency int, duration time.Duration) ([]benchSample, time.Duration) {
+	var samples []benchSample
+	var mu sync.Mutex
+	var next uint64
+	var wg sync.WaitGroup
+
+	chatURL := "/api/chat/" + url.PathEscape(agentName)
+	start := time.Now()
+	end := start.Add(duration)
+
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(end) && c.ctx.Err() == nil {
+				// pick the prompts round robin across all workers
+				prompt := prompts[atomic.AddUint64(&next, 1)%uint64(len(prompts))]
+				payload := ChatRequest{
+					Prompt:   prompt,
+					Messages: []ChatMessage{{Role: "user", Content: prompt}},
+				}
+				sample := c.benchChatRequest(chatURL, payload)
+				if c.ctx.Err() != nil {
+					// requests cut short by Ctrl-C are not counted
+					break
+				}
+
+				mu.Lock()
+				samples = append(samples, sample)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return samples, time.Since(start)
+}
+
+// benchChatRequest sends one chat request of the benchmark. Failures are
+// counted as errors of the run, a worker must not exit the benchmark
+func (c *cli) benchChatRequest(chatURL string, payload ChatRequest) benchSample {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return benchSample{status: benchRequestError}
+	}
+	req, err := c.newRequest(c.ctx, "POST", chatURL, bytes.NewReader(body), "application/json")
+	if err != nil {
+		return benchSample{status: benchRequestError}
+	}
+
+	requestStart := time.Now()
+	res, _, err := c.doHttpRequest(req)
+	sample := benchSample{latency: time.Since(requestStart)}
+	if err != nil {
+		sample.status = "conn error"
+	} else {
+		sample.status = fmt.Sprintf("%d", res.StatusCode)
+	}
+	return sample
+}
+
+func buildBenchReport(agentName string, concurrency int, samples []benchSample, elapsed time.Duration, withHistogram bool) BenchReport {
+	report := BenchReport{
+		Agent:       agentName,
+		Concurrency: concurrency,
+		Seconds:     elapsed.Seconds(),
+		Requests:    len(samples),
+		StatusCodes: map[string]int{},
+	}
+
+	var latencies []time.Duration
+	var total time.Duration
+	for _, sample := range samples {
+		report.StatusCodes[sample.status]++
+		if code := sample.status; len(code) == 3 && code[0] == '2' {
+			report.Succeeded++
+		} else {
+			report.Failed++
+		}
+		if sample.status == benchRequestError {
+			continue
+		}
+		latencies = append(latencies, sample.latency)
+		total += sample.latency
+	}
+	if len(samples) == 0 {
+		return report
+	}
+
+	report.Throughput = float64(report.Requests) / elapsed.Seconds()
+	report.ErrorRate = float64(report.Failed) / float64(report.Requests)
+	if len(latencies) == 0 {
+		return report
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	report.Latency = BenchLatencies{
+		Min:  toMillis(latencies[0]),
+		Mean: toMillis(total / time.Duration(len(latencies))),
+		P50:  toMillis(percentile(latencies, 50)),
+		P90:  toMillis(percentile(latencies, 90)),
+		P99:  toMillis(percentile(latencies, 99)),
+		Max:  toMillis(latencies[len(latencies)-1]),
+	}
+	if withHistogram {
+		report.Histogram = percentileDistribution(latencies)
+	}
+	return report
+}
+
+// percentile returns the nearest-rank percentile of sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	return sorted[nearestRank(len(sorted), p)-1]
+}
+
+func nearestRank(count int, p float64) int {
+	rank := int(math.Ceil(p / 100 * float64(count)))
+	if rank < 1 {
+		return 1
+	}
+	if rank > count {
+		return count
+	}
+	return rank
+}
+
+// percentileDistribution follows the HdrHistogram output, halving the
+// distance to 100% at every level so that the tail gets more detail
+func percentileDistribution(sorted []time.Duration) []BenchHistogramRow {
+	var rows []BenchHistogramRow
+	add := func(p float64) {
+		rank := nearestRank(len(sorted), p)
+		rows = append(rows, BenchHistogramRow{
+			ValueMs:    toMillis(sorted[rank-1]),
+			Percentile: p / 100,
+			TotalCount: rank,
+		})
+	}
+	// below one sample per step every further level would show the max
+	for remaining := 100.0; remaining > 100/float64(len(sorted)); remaining /= 2 {
+		add(100 - remaining)
+		add(100 - remaining*3/4)
+	}
+	add(100)
+	return rows
+}
+
+func toMillis(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func displayBenchReport(out io.Writer, report BenchReport) {
+	fmt.Fprintf(out, "%-14s %d (%d succeeded, %d failed)\n", "Requests:", report.Requests, report.Succeeded, report.Failed)
+	fmt.Fprintf(out, "%-14s %.2fs\n", "Duration:", report.Seconds)
+	fmt.Fprintf(out, "%-14s %.2f req/s\n", "Throughput:", report.Throughput)
+	fmt.Fprintf(out, "%-14s %.2f%%\n", "Error rate:", report.ErrorRate*100)
+	fmt.Fprintln(out)
+
+	// status codes in a stable order
+	var codes []string
+	for code := range report.StatusCodes {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	fmt.Fprintf(out, "%-12s %-8s %s\n", "STATUS", "COUNT", "SHARE")
+	fmt.Fprintln(out, strings.Repeat("-", 30))
+	for _, code := range codes {
+		count := report.StatusCodes[code]
+		fmt.Fprintf(out, "%-12s %-8d %.2f%%\n", code, count, float64(count)*100/float64(report.Requests))
+	}
+	fmt.Fprintln(out)
+
+	headerFormat := "%-10s %-10s %-10s %-10s %-10s %-10s\n"
+	fmt.Fprintf(out, headerFormat, "MIN", "MEAN", "P50", "P90", "P99", "MAX")
+	fmt.Fprintln(out, strings.Repeat("-", 65))
+	ms := func(v float64) string { return fmt.Sprintf("%.1fms", v) }
+	fmt.Fprintf(out, headerFormat, ms(report.Latency.Min), ms(report.Latency.Mean), ms(report.Latency.P50),
+		ms(report.Latency.P90), ms(report.Latency.P99), ms(report.Latency.Max))
+	fmt.Fprintln(out)
+
+	if len(report.Histogram) > 0 {
+		fmt.Fprintf(out, "%12s %14s %12s %18s\n", "Value(ms)", "Percentile", "TotalCount", "1/(1-Percentile)")
+		fmt.Fprintln(out)
+		for _, row := range report.Histogram {
+			inverse := "inf"
+			if row.Percentile < 1 {
+				inverse = fmt.Sprintf("%.2f", 1/(1-row.Percentile))
+			}
+			fmt.Fprintf(out, "%12.3f %14.6f %12d %18s\n", row.ValueMs, row.Percentile, row.TotalCount, inverse)
+		}
+		fmt.Fprintln(out)
+	}
+}
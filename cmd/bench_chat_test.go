@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"sia-cli/internal/fakeserver"
+)
+
+// TestPercentile checks the nearest-rank percentiles of sorted latencies
+func TestPercentile(t *testing.T) {
+	var latencies []time.Duration
+	for i := 1; i <= 10; i++ {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0, 1 * time.Millisecond},
+		{10, 1 * time.Millisecond},
+		{11, 2 * time.Millisecond},
+		{50, 5 * time.Millisecond},
+		{90, 9 * time.Millisecond},
+		{99, 10 * time.Millisecond},
+		{100, 10 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := percentile(latencies, tt.p); got != tt.want {
+			t.Errorf("percentile(1..10ms, %v) = %s, want %s", tt.p, got, tt.want)
+		}
+	}
+	if got := percentile([]time.Duration{time.Second}, 99); got != time.Second {
+		t.Errorf("percentile of one sample = %s, want 1s", got)
+	}
+}
+
+// TestPercentileDistribution checks the rows halve the distance to 100% and
+// stop when there are no more samples to show
+func TestPercentileDistribution(t *testing.T) {
+	var latencies []time.Duration
+	for i := 1; i <= 8; i++ {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	want := []BenchHistogramRow{
+		{ValueMs: 1, Percentile: 0, TotalCount: 1},
+		{ValueMs: 2, Percentile: 0.25, TotalCount: 2},
+		{ValueMs: 4, Percentile: 0.5, TotalCount: 4},
+		{ValueMs: 5, Percentile: 0.625, TotalCount: 5},
+		{ValueMs: 6, Percentile: 0.75, TotalCount: 6},
+		{ValueMs: 7, Percentile: 0.8125, TotalCount: 7},
+		{ValueMs: 8, Percentile: 1, TotalCount: 8},
+	}
+	got := percentileDistribution(latencies)
+	if len(got) != len(want) {
+		t.Fatalf("percentileDistribution = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("row %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+// TestBuildBenchReport checks requests are counted by status and requests
+// that were never sent do not count towards the latencies
+func TestBuildBenchReport(t *testing.T) {
+	samples := []benchSample{
+		{status: "200", latency: 10 * time.Millisecond},
+		{status: "200", latency: 30 * time.Millisecond},
+		{status: "500", latency: 20 * time.Millisecond},
+		{status: benchRequestError},
+	}
+	report := buildBenchReport("kb", 2, samples, 2*time.Second, false)
+
+	if report.Requests != 4 || report.Succeeded != 2 || report.Failed != 2 {
+		t.Errorf("requests = %d, succeeded = %d, failed = %d, want 4, 2 and 2", report.Requests, report.Succeeded, report.Failed)
+	}
+	if report.StatusCodes[benchRequestError] != 1 {
+		t.Errorf("status codes = %v, want one %q", report.StatusCodes, benchRequestError)
+	}
+	if report.Throughput != 2 || report.ErrorRate != 0.5 {
+		t.Errorf("throughput = %v, error rate = %v, want 2 and 0.5", report.Throughput, report.ErrorRate)
+	}
+	want := BenchLatencies{Min: 10, Mean: 20, P50: 20, P90: 30, P99: 30, Max: 30}
+	if report.Latency != want {
+		t.Errorf("latency = %+v, want %+v", report.Latency, want)
+	}
+
+	// only requests that were never sent
+	report = buildBenchReport("kb", 1, []benchSample{{status: benchRequestError}}, time.Second, true)
+	if report.Failed != 1 || report.Latency != (BenchLatencies{}) || report.Histogram != nil {
+		t.Errorf("report of unsent requests = %+v", report)
+	}
+}
+
+// TestBenchChatRequestErrors checks a request that cannot be built is
+// counted instead of exiting the benchmark from its worker
+func TestBenchChatRequestErrors(t *testing.T) {
+	c := newTestCLI(t, map[string]string{"SIA_SERVER_URL": "http://[::1", "SIA_API_KEY": "test-key"})
+	sample := c.benchChatRequest("/api/chat/kb", ChatRequest{Prompt: "Hi"})
+	if sample.status != benchRequestError {
+		t.Errorf("status = %q, want %q", sample.status, benchRequestError)
+	}
+}
+
+// TestRunChatBench runs a short benchmark against the fake server with an
+// agent name that has to be escaped in the URL
+func TestRunChatBench(t *testing.T) {
+	server := fakeserver.New(fakeserver.Options{APIKey: "test-key", Script: map[string]string{"Hi": "Hello."}})
+	server.AddAgent(fakeserver.Agent{Name: "kb v2"})
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	c := newTestCLI(t, map[string]string{"SIA_SERVER_URL": ts.URL, "SIA_API_KEY": "test-key"})
+	c.profile.Retries = 0
+	samples, _ := c.runChatBench("kb v2", []string{"Hi"}, 2, 50*time.Millisecond)
+	if len(samples) == 0 {
+		t.Fatal("no requests were sent")
+	}
+	for _, sample := range samples {
+		if sample.status != "200" {
+			t.Fatalf("status = %q, want 200", sample.status)
+		}
+	}
+}
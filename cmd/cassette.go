@@ -0,0 +1,299 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+)
+
+// errNotRecorded is returned while replaying a request the cassette has no
+// response to. It is not retried
+var errNotRecorded = errors.New("no recorded response")
+
+// addCassetteFlags adds --record and --replay
+func (c *cli) addCassetteFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&c.recordFile, "record", "", "Save the requests and responses of the command to this cassette file, with secrets redacted")
+	cmd.PersistentFlags().StringVar(&c.replayFile, "replay", "", "Answer the requests from this cassette file instead of the server")
+	cmd.MarkFlagsMutuallyExclusive("record", "replay")
+}
+
+// initCassette opens the cassette of --record or --replay
+func (c *cli) initCassette() {
+	switch {
+	case c.recordFile != "":
+		recording, err := newCassette(c.resolvePath(c.recordFile), c.stderr)
+		if err != nil {
+			c.handleErr(err, "Failed to write the cassette")
+		}
+		c.httpCassette = recording
+	case c.replayFile != "":
+		replaying, err := loadCassette(c.resolvePath(c.replayFile))
+		if err != nil {
+			c.handleErr(err, "Failed to read the cassette")
+		}
+		c.httpCassette = replaying
+	}
+}
+
+// cassette is a file of recorded requests and responses. While recording the
+// file is rewritten after every request so it is complete even when the
+// command exits early. While replaying each recorded request is answered once
+type cassette struct {
+	mu        sync.Mutex
+	path      string
+	replaying bool
+	file      cassetteFile
+	used      []bool       // the interactions already replayed
+	store     *replayStore // the credentials while replaying
+	// warnings about the file are written here while recording
+	warnings io.Writer
+}
+
+type cassetteFile struct {
+	Version      int                   `json:"version"`
+	SiaVersion   string                `json:"sia_version"`
+	RecordedAt   string                `json:"recorded_at"`
+	Interactions []cassetteInteraction `json:"interactions"`
+}
+
+// cassetteInteraction is a request and its response, or the error it failed with
+type cassetteInteraction struct {
+	Request  cassetteRequest   `json:"request"`
+	Response *cassetteResponse `json:"response,omitempty"`
+	Error    string            `json:"error,omitempty"`
+}
+
+type cassetteRequest struct {
+	Method       string      `json:"method"`
+	URL          string      `json:"url"`
+	Headers      http.Header `json:"headers"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"body_encoding,omitempty"` // base64 for binary bodies
+}
+
+type cassetteResponse struct {
+	Status       int         `json:"status"`
+	Headers      http.Header `json:"headers"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"body_encoding,omitempty"`
+}
+
+func newCassette(path string, warnings io.Writer) (*cassette, error) {
+	c := &cassette{path: path, warnings: warnings, file: cassetteFile{
+		Version:      1,
+		SiaVersion:   version,
+		RecordedAt:   time.Now().UTC().Format(time.RFC3339),
+		Interactions: []cassetteInteraction{},
+	}}
+	// fail early when the file cannot be written
+	if err := c.write(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func loadCassette(path string) (*cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &cassette{path: path, replaying: true}
+	if err := json.Unmarshal(data, &c.file); err != nil {
+		return nil, fmt.Errorf("%s is not a cassette written with --record: %w", path, err)
+	}
+	if c.file.Version != 1 {
+		return nil, fmt.Errorf("%s was recorded by a newer version of sia", path)
+	}
+	c.used = make([]bool, len(c.file.Interactions))
+	return c, nil
+}
+
+// withCassette records or replays the requests sent through the transport
+// when --record or --replay is given
+func (c *cli) withCassette(base http.RoundTripper) http.RoundTripper {
+	if c.httpCassette == nil {
+		return base
+	}
+	return &cassetteTransport{base: base, cassette: c.httpCassette}
+}
+
+type cassetteTransport struct {
+	base     http.RoundTripper
+	cassette *cassette
+}
+
+func (t *cassetteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.cassette.replaying {
+		return t.cassette.replay(req)
+	}
+
+	// read a copy of the request body so the one sent is left untouched
+	var reqBody []byte
+	if req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			reqBody, _ = io.ReadAll(body)
+			body.Close()
+		}
+	}
+	interaction := cassetteInteraction{Request: cassetteRequest{
+		Method:  req.Method,
+		URL:     req.URL.String(),
+		Headers: redactHeaders(req.Header),
+	}}
+	interaction.Request.Body, interaction.Request.BodyEncoding = encodeCassetteBody(redactBody(req.Header.Get("Content-Type"), reqBody))
+
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		interaction.Error = err.Error()
+		t.cassette.add(interaction)
+		return nil, err
+	}
+
+	// read the response body and hand the caller a copy of it
+	resBody, readErr := io.ReadAll(res.Body)
+	res.Body.Close()
+	var body io.Reader = bytes.NewReader(resBody)
+	if readErr != nil {
+		body = io.MultiReader(body, errReader{readErr})
+	}
+	res.Body = io.NopCloser(body)
+
+	interaction.Response = &cassetteResponse{Status: res.StatusCode, Headers: redactHeaders(res.Header)}
+	interaction.Response.Body, interaction.Response.BodyEncoding = encodeCassetteBody(redactBody(res.Header.Get("Content-Type"), resBody))
+	t.cassette.add(interaction)
+	return res, nil
+}
+
+// add appends an interaction and rewrites the file
+func (c *cassette) add(interaction cassetteInteraction) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.file.Interactions = append(c.file.Interactions, interaction)
+	if err := c.write(); err != nil {
+		fmt.Fprintf(c.warnings, "Warning: failed to write the cassette: %v\n", err)
+	}
+}
+
+func (c *cassette) write() error {
+	data, err := json.MarshalIndent(c.file, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, append(data, '\n'), 0600)
+}
+
+// replay answers with the first recorded response to the same method and
+// path that has not been used yet. The server is not compared so a cassette
+// can be replayed with any SIA_SERVER_URL
+func (c *cassette) replay(req *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, interaction := range c.file.Interactions {
+		if c.used[i] || interaction.Request.Method != req.Method || !sameRequestURI(interaction.Request.URL, req) {
+			continue
+		}
+		c.used[i] = true
+		if interaction.Response == nil {
+			return nil, errors.New(interaction.Error)
+		}
+
+		body, err := decodeCassetteBody(interaction.Response.Body, interaction.Response.BodyEncoding)
+		if err != nil {
+			return nil, fmt.Errorf("%s has a damaged response to %s %s: %w", c.path, req.Method, req.URL.RequestURI(), err)
+		}
+		headers := interaction.Response.Headers
+		if headers == nil {
+			headers = http.Header{}
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", interaction.Response.Status, http.StatusText(interaction.Response.Status)),
+			StatusCode:    interaction.Response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        headers.Clone(),
+			Body:          io.NopCloser(bytes.NewReader(body)),
+			ContentLength: int64(len(body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w to %s %s in %s", errNotRecorded, req.Method, req.URL.RequestURI(), c.path)
+}
+
+// sameRequestURI compares the path and query of a recorded URL with the request
+func sameRequestURI(recorded string, req *http.Request) bool {
+	parsed, err := req.URL.Parse(recorded)
+	return err == nil && parsed.RequestURI() == req.URL.RequestURI()
+}
+
+func encodeCassetteBody(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
+
+func decodeCassetteBody(body, encoding string) ([]byte, error) {
+	switch encoding {
+	case "":
+		return []byte(body), nil
+	case "base64":
+		return base64.StdEncoding.DecodeString(body)
+	}
+	return nil, fmt.Errorf("unknown body encoding %q", encoding)
+}
+
+// replayStore keeps the secrets in memory while replaying, so that the saved
+// login is neither needed nor changed by the recorded responses
+type replayStore struct {
+	mu      sync.Mutex
+	secrets map[string]string
+}
+
+func newReplayStore(serverURL string) *replayStore {
+	return &replayStore{secrets: map[string]string{
+		// the recorded requests carry a redacted token too
+		credentialAccessToken: redacted,
+		credentialTokenServer: serverURL,
+	}}
+}
+
+func (s *replayStore) Name() string { return "replay" }
+
+func (s *replayStore) Get(key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	value, ok := s.secrets[key]
+	if !ok {
+		return "", errCredentialNotFound
+	}
+	return value, nil
+}
+
+func (s *replayStore) Set(key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.secrets[key] = value
+	return nil
+}
+
+func (s *replayStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.secrets[key]; !ok {
+		return errCredentialNotFound
+	}
+	delete(s.secrets, key)
+	return nil
+}
@@ -13,68 +13,90 @@ type ChangePwInput struct {
 	RepeatPassword  string
 }
 
-var changePwInput ChangePwInput
-
-// setpwdCmd represents the set password command
-var changepwdCmd = &cobra.Command{
-	Use:     "changepwd",
-	Short:   "Change the admin password",
-	Aliases: []string{"cpw"},
-	Long: `
+// newChangepwdCmd builds the change password command
+func newChangepwdCmd(c *cli) *cobra.Command {
+	// Run against a server that is not on this machine
+	var changepwdAllowRemote bool
+	// Read the passwords from stdin instead of prompting
+	var changepwdPasswordStdin bool
+
+	cmd := &cobra.Command{
+		Use:     "changepwd",
+		Short:   "Change the admin password",
+		Aliases: []string{"cpw"},
+		Long: `
 1. To change the admin password.
-2. This command can be used only from the server console not a remote terminal console.`,
-
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		checkEnvVars()
-	},
-	Run: func(cmd *cobra.Command, args []string) {
-
-		// confirm access is from server console
-		confirmIfLocalHost()
-
-		// Prompt forcurrent password
-		changePwInput.CurrentPassword = readHiddenTextInput("Enter the current admin password: ")
-
-		// Prompt for password
-		changePwInput.Password = readHiddenTextInput("Enter a new strong password (min 6 chars): ")
-		// prompt for repeat password
-		changePwInput.RepeatPassword = readVisibleTextInput("Repeat above password: ")
-
-		// Check if passwords match
-		if changePwInput.Password != changePwInput.RepeatPassword {
-			fmt.Println("Passwords do not match.")
-			fmt.Println()
-			return
-		}
-
-		// set the login URL
-		setpwURL := "/api/auth/update-admin-password"
-
-		// Create the payload as JSON
-		payload := map[string]string{
-			"current_password": changePwInput.CurrentPassword,
-			"new_password":     changePwInput.Password,
-		}
-
-		// Get the request body
-		reqBody := generateJSONBody(payload)
-
-		// Create the POST request
-		req := createAuthHttpClient("POST", setpwURL, reqBody, "application/json")
-
-		// Execute HTTP client
-		res, resBody := executeHttpRequest(req)
-
-		//Check status code
-		checkResponseStatusCode(res, resBody)
-
-		// Print the successful response
-		fmt.Println("Admin password successfully changed.")
-		fmt.Println()
-
-	},
-}
-
-func init() {
-	rootCmd.AddCommand(changepwdCmd)
+2. This command can be used only from the server console not a remote terminal console.
+3. SIA_SERVER_URL must be an http or https URL of localhost or a loopback address such as 127.0.0.1 or [::1].
+   Unix socket URLs are not supported.
+   Use --allow-remote to override this on a trusted network.
+4. The new password is checked against the password_policy of the profile, see 'sia setpwd --help'.
+5. For automation, pipe the current and the new password in on two lines with --password-stdin.`,
+
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			c.checkEnvVars()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// confirm access is from server console
+			c.confirmIfLocalHost(changepwdAllowRemote)
+
+			var changePwInput ChangePwInput
+			if changepwdPasswordStdin {
+				// read the current and the new password piped in by automation
+				passwords := c.readPasswordLinesStdin(2)
+				changePwInput.CurrentPassword = passwords[0]
+				changePwInput.Password = passwords[1]
+			} else {
+				// Prompt forcurrent password
+				changePwInput.CurrentPassword = c.readHiddenTextInput("Enter the current admin password: ")
+
+				// Prompt for password
+				changePwInput.Password = c.readHiddenTextInput(fmt.Sprintf("Enter a new strong password (min %d chars): ", c.profile.PasswordPolicy.MinLength))
+				// prompt for repeat password
+				changePwInput.RepeatPassword = c.readHiddenTextInput("Repeat above password: ")
+
+				// Check if passwords match
+				if changePwInput.Password != changePwInput.RepeatPassword {
+					fmt.Fprintln(c.stdout, "Passwords do not match.")
+					fmt.Fprintln(c.stdout)
+					return
+				}
+			}
+
+			// Check the new password against the local policy
+			c.enforcePasswordPolicy(changePwInput.Password, changePwInput.CurrentPassword)
+
+			// set the login URL
+			setpwURL := "/api/auth/update-admin-password"
+
+			// Create the payload as JSON
+			payload := map[string]string{
+				"current_password": changePwInput.CurrentPassword,
+				"new_password":     changePwInput.Password,
+			}
+
+			// Get the request body
+			reqBody := c.generateJSONBody(payload)
+
+			// Create the POST request
+			req := c.createAuthHttpClient("POST", setpwURL, reqBody, "application/json")
+
+			// Execute HTTP client
+			res, resBody := c.executeHttpRequest(req)
+
+			//Check status code
+			c.checkResponseStatusCode(res, resBody)
+
+			// Print the successful response
+			fmt.Fprintln(c.stdout, "Admin password successfully changed.")
+			fmt.Fprintln(c.stdout)
+
+		},
+	}
+
+	cmd.Flags().BoolVar(&changepwdPasswordStdin, "password-stdin", false, "Read the current and the new password from stdin, one per line")
+	cmd.Flags().BoolVar(&changepwdAllowRemote, "allow-remote", false, "Allow SIA_SERVER_URL to be a remote server")
+
+	return cmd
 }
@@ -0,0 +1,213 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+const (
+	ChatHistoryFilename = "chat_history"
+	chatHistoryMaxLen   = 1000
+	// a line with only this marker starts and ends a multi-line prompt
+	multiLineMarker = `"""`
+)
+
+// chatReader reads the prompts typed by the user during a chat session
+type chatReader interface {
+	// ReadPrompt returns the next prompt, or io.EOF when the user is done
+	ReadPrompt(prompt, continuation string) (string, error)
+	Close()
+}
+
+// newChatReader returns a line editor with history when stdin is a terminal
+// and a plain line reader otherwise
+func (c *cli) newChatReader() chatReader {
+	fd, stdinOK := terminalFd(c.stdin)
+	if _, stdoutOK := terminalFd(c.stdout); !stdinOK || !stdoutOK {
+		return &plainChatReader{reader: c.lineReader(), out: c.stdout}
+	}
+
+	history := c.loadChatHistory()
+	terminal := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{c.stdin, c.stdout}, "")
+	terminal.History = history
+	if width, height, err := term.GetSize(fd); err == nil && width > 0 {
+		terminal.SetSize(width, height)
+	}
+	return &ttyChatReader{fd: fd, terminal: terminal, history: history}
+}
+
+// ttyChatReader edits lines in raw mode with cursor movement, up-arrow
+// recall and bracketed paste so pasted text is sent as one prompt
+type ttyChatReader struct {
+	fd       int
+	terminal *term.Terminal
+	history  *chatHistory
+}
+
+func (r *ttyChatReader) ReadPrompt(prompt, continuation string) (string, error) {
+	// raw mode only while reading so that answers print normally
+	state, err := term.MakeRaw(r.fd)
+	if err != nil {
+		return "", err
+	}
+	defer term.Restore(r.fd, state)
+	return readTerminalPrompt(r.terminal, prompt, continuation)
+}
+
+// readTerminalPrompt reads lines from the line editor until a prompt is
+// complete, with pasted lines kept together
+func readTerminalPrompt(terminal *term.Terminal, prompt, continuation string) (string, error) {
+	terminal.SetBracketedPasteMode(true)
+	defer terminal.SetBracketedPasteMode(false)
+
+	var lines promptLines
+	terminal.SetPrompt(prompt)
+	for {
+		line, err := terminal.ReadLine()
+		pasted := errors.Is(err, term.ErrPasteIndicator)
+		if err != nil && !pasted {
+			return "", err
+		}
+		terminal.SetPrompt(continuation)
+		if lines.add(line, pasted) {
+			return lines.String(), nil
+		}
+	}
+}
+
+func (r *ttyChatReader) Close() {
+	r.history.save()
+}
+
+// plainChatReader reads prompts line by line when stdin is not a terminal
+type plainChatReader struct {
+	reader *bufio.Reader
+	out    io.Writer
+}
+
+func (r *plainChatReader) ReadPrompt(prompt, continuation string) (string, error) {
+	var lines promptLines
+	fmt.Fprint(r.out, prompt)
+	for {
+		line, err := r.reader.ReadString('\n')
+		if err != nil && (line == "" || lines.multiLine) {
+			return "", err
+		}
+		if lines.add(strings.TrimRight(line, "\r\n"), false) {
+			return lines.String(), nil
+		}
+	}
+}
+
+func (r *plainChatReader) Close() {}
+
+// promptLines assembles a prompt from the lines read, which spans several
+// lines between two multiLineMarker lines or when the lines were pasted
+type promptLines struct {
+	lines     []string
+	multiLine bool
+}
+
+// add adds the next line and reports whether the prompt is complete
+func (p *promptLines) add(line string, pasted bool) bool {
+	switch {
+	case strings.TrimSpace(line) == multiLineMarker:
+		// toggle multi-line mode, sending what was collected on close
+		if p.multiLine {
+			return true
+		}
+		p.multiLine = true
+	case p.multiLine || pasted:
+		// keep collecting until the closing marker or the end of the paste
+		p.lines = append(p.lines, line)
+	default:
+		if line != "" || len(p.lines) == 0 {
+			p.lines = append(p.lines, line)
+		}
+		return true
+	}
+	return false
+}
+
+func (p *promptLines) String() string {
+	return strings.Join(p.lines, "\n")
+}
+
+// chatHistory implements term.History and is persisted to ~/.sia/chat_history
+type chatHistory struct {
+	path    string
+	entries []string // oldest first
+}
+
+func (c *cli) loadChatHistory() *chatHistory {
+	history := &chatHistory{}
+	homeDir, err := c.userHomeDir()
+	if err != nil {
+		return history
+	}
+	history.path = filepath.Join(homeDir, TokenDir, ChatHistoryFilename)
+
+	data, err := os.ReadFile(history.path)
+	if err != nil {
+		return history
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line != "" {
+			history.entries = append(history.entries, line)
+		}
+	}
+	if len(history.entries) > chatHistoryMaxLen {
+		history.entries = history.entries[len(history.entries)-chatHistoryMaxLen:]
+	}
+	return history
+}
+
+func (h *chatHistory) Add(entry string) {
+	entry = strings.TrimSpace(entry)
+	// skip blanks, commands and repeats of the last entry
+	if entry == "" || entry == "q" || entry == multiLineMarker || strings.ContainsAny(entry, "\r\n") {
+		return
+	}
+	if len(h.entries) > 0 && h.entries[len(h.entries)-1] == entry {
+		return
+	}
+	h.entries = append(h.entries, entry)
+	if len(h.entries) > chatHistoryMaxLen {
+		h.entries = h.entries[1:]
+	}
+	// save right away as a failed request exits the process
+	h.save()
+}
+
+func (h *chatHistory) Len() int {
+	return len(h.entries)
+}
+
+func (h *chatHistory) At(idx int) string {
+	return h.entries[len(h.entries)-1-idx]
+}
+
+// save writes the history, ignoring errors as it is only a convenience
+func (h *chatHistory) save() {
+	if h.path == "" {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0700); err != nil {
+		return
+	}
+	data := strings.Join(h.entries, "\n")
+	if data != "" {
+		data += "\n"
+	}
+	os.WriteFile(h.path, []byte(data), 0600)
+}
@@ -0,0 +1,243 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/term"
+)
+
+// TestPromptLines checks how the lines read are assembled into a prompt
+func TestPromptLines(t *testing.T) {
+	type input struct {
+		line   string
+		pasted bool
+	}
+	tests := []struct {
+		name  string
+		lines []input
+		want  string
+	}{
+		{"one line", []input{{"hello", false}}, "hello"},
+		{"empty line", []input{{"", false}}, ""},
+		{"multi-line", []input{{`"""`, false}, {"one", false}, {"", false}, {"two", false}, {`"""`, false}}, "one\n\ntwo"},
+		{"marker with spaces", []input{{` """ `, false}, {"one", false}, {`"""  `, false}}, "one"},
+		{"empty multi-line", []input{{`"""`, false}, {`"""`, false}}, ""},
+		{"paste ended by enter", []input{{"one", true}, {"two", false}}, "one\ntwo"},
+		{"paste ending with a line break", []input{{"one", true}, {"two", true}, {"", false}}, "one\ntwo"},
+		{"paste with blank lines", []input{{"one", true}, {"", true}, {"two", true}, {"", false}}, "one\n\ntwo"},
+		{"paste in multi-line", []input{{`"""`, false}, {"one", true}, {"two", true}, {"three", false}, {`"""`, false}}, "one\ntwo\nthree"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lines promptLines
+			for i, in := range tt.lines {
+				complete := lines.add(in.line, in.pasted)
+				if last := i == len(tt.lines)-1; complete != last {
+					t.Fatalf("add(%q) after %d lines = %v, want %v", in.line, i, complete, last)
+				}
+			}
+			if got := lines.String(); got != tt.want {
+				t.Errorf("prompt = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// readAllPrompts reads prompts until an error and returns them with the error
+func readAllPrompts(reader chatReader) ([]string, error) {
+	var prompts []string
+	for {
+		prompt, err := reader.ReadPrompt("> ", ". ")
+		if err != nil {
+			return prompts, err
+		}
+		prompts = append(prompts, prompt)
+	}
+}
+
+// TestPlainChatReader checks prompts are read line by line when stdin is not
+// a terminal, with multi-line prompts between markers
+func TestPlainChatReader(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"lines", "hello\nworld\n", []string{"hello", "world"}},
+		{"windows line breaks", "hello\r\nworld\r\n", []string{"hello", "world"}},
+		{"last line without a line break", "hello\nworld", []string{"hello", "world"}},
+		{"blank line", "\nhello\n", []string{"", "hello"}},
+		{"multi-line", "hi\n\"\"\"\none\n\ntwo\n\"\"\"\nbye\n", []string{"hi", "one\n\ntwo", "bye"}},
+		{"unterminated multi-line", "hi\n\"\"\"\none\ntwo", []string{"hi"}},
+		{"long line", strings.Repeat("a", 100000) + "\n", []string{strings.Repeat("a", 100000)}},
+		{"nothing", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			reader := &plainChatReader{reader: bufio.NewReader(strings.NewReader(tt.input)), out: &out}
+			prompts, err := readAllPrompts(reader)
+			if !errors.Is(err, io.EOF) {
+				t.Errorf("error = %v, want EOF", err)
+			}
+			if !reflect.DeepEqual(prompts, tt.want) {
+				t.Errorf("prompts = %q, want %q", prompts, tt.want)
+			}
+			if want := strings.Repeat("> ", len(tt.want)+1); out.String() != want {
+				t.Errorf("output = %q, want %q", out.String(), want)
+			}
+		})
+	}
+}
+
+// TestNewChatReaderPlain checks the plain reader is used without a terminal
+func TestNewChatReaderPlain(t *testing.T) {
+	c := newTestCLI(t, nil)
+	c.stdin = strings.NewReader("hello\n")
+	reader := c.newChatReader()
+	defer reader.Close()
+	if _, ok := reader.(*plainChatReader); !ok {
+		t.Fatalf("newChatReader = %T, want a plainChatReader", reader)
+	}
+	if prompt, err := reader.ReadPrompt("> ", ". "); prompt != "hello" || err != nil {
+		t.Errorf("ReadPrompt = %q, %v, want hello", prompt, err)
+	}
+}
+
+// newTestTerminal returns a line editor that reads the keys typed from input
+func newTestTerminal(input string, history term.History) *term.Terminal {
+	terminal := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{strings.NewReader(input), io.Discard}, "")
+	terminal.History = history
+	return terminal
+}
+
+// TestReadTerminalPrompt checks the prompts read from the line editor, with
+// bracketed paste and multi-line markers
+func TestReadTerminalPrompt(t *testing.T) {
+	const pasteStart, pasteEnd = "\x1b[200~", "\x1b[201~"
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{"typed lines", "hello\rworld\r", []string{"hello", "world"}},
+		{"edited line", "helo\x1b[Dl\r", []string{"hello"}},
+		{"paste then enter", pasteStart + "one\rtwo" + pasteEnd + "\r", []string{"one\ntwo"}},
+		{"paste ending with a line break", pasteStart + "one\rtwo\r" + pasteEnd + "\r", []string{"one\ntwo"}},
+		{"paste then more text", pasteStart + "one\rtwo" + pasteEnd + " three\r", []string{"one\ntwo three"}},
+		{"paste of a marker", pasteStart + "\"\"\"\rone\r\"\"\"\r" + pasteEnd, []string{"one"}},
+		{"multi-line", "hi\r\"\"\"\rone\r\rtwo\r\"\"\"\rbye\r", []string{"hi", "one\n\ntwo", "bye"}},
+		{"control-d", "hello\r\x04", []string{"hello"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			terminal := newTestTerminal(tt.input, &chatHistory{})
+			var prompts []string
+			for {
+				prompt, err := readTerminalPrompt(terminal, "> ", ". ")
+				if err != nil {
+					if !errors.Is(err, io.EOF) {
+						t.Errorf("error = %v, want EOF", err)
+					}
+					break
+				}
+				prompts = append(prompts, prompt)
+			}
+			if !reflect.DeepEqual(prompts, tt.want) {
+				t.Errorf("prompts = %q, want %q", prompts, tt.want)
+			}
+		})
+	}
+}
+
+// TestChatHistoryRecall checks the up arrow recalls earlier prompts and the
+// prompts typed are added to the saved history
+func TestChatHistoryRecall(t *testing.T) {
+	c := newTestCLI(t, nil)
+	history := c.loadChatHistory()
+	history.Add("first")
+	history.Add("second")
+
+	terminal := newTestTerminal("\x1b[A\x1b[A\r\x1b[A\r", history)
+	for _, want := range []string{"first", "first"} {
+		prompt, err := readTerminalPrompt(terminal, "> ", ". ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if prompt != want {
+			t.Errorf("prompt = %q, want %q", prompt, want)
+		}
+	}
+
+	// the recalled prompt is not repeated
+	if !reflect.DeepEqual(c.loadChatHistory().entries, []string{"first", "second", "first"}) {
+		t.Errorf("saved history = %q, want first, second, first", c.loadChatHistory().entries)
+	}
+}
+
+// TestChatHistoryAdd checks which entries are kept and their order
+func TestChatHistoryAdd(t *testing.T) {
+	history := &chatHistory{}
+	for _, entry := range []string{"hello", "  hello ", "", "   ", "q", `"""`, "one\ntwo", "world"} {
+		history.Add(entry)
+	}
+	if want := []string{"hello", "world"}; !reflect.DeepEqual(history.entries, want) {
+		t.Errorf("entries = %q, want %q", history.entries, want)
+	}
+	if history.Len() != 2 || history.At(0) != "world" || history.At(1) != "hello" {
+		t.Errorf("At(0), At(1) = %q, %q, want the newest first", history.At(0), history.At(1))
+	}
+
+	for i := 0; i < chatHistoryMaxLen+5; i++ {
+		history.Add(fmt.Sprintf("prompt %d", i))
+	}
+	if history.Len() != chatHistoryMaxLen || history.At(0) != fmt.Sprintf("prompt %d", chatHistoryMaxLen+4) {
+		t.Errorf("history has %d entries, newest %q, want the last %d", history.Len(), history.At(0), chatHistoryMaxLen)
+	}
+}
+
+// TestLoadChatHistory checks the history is read back from ~/.sia and
+// trimmed to the most recent entries
+func TestLoadChatHistory(t *testing.T) {
+	c := newTestCLI(t, nil)
+	if history := c.loadChatHistory(); history.Len() != 0 {
+		t.Errorf("history without a file has %d entries", history.Len())
+	}
+
+	history := c.loadChatHistory()
+	history.Add("hello")
+	history.Add("world")
+	if got := c.loadChatHistory().entries; !reflect.DeepEqual(got, []string{"hello", "world"}) {
+		t.Errorf("loaded history = %q, want hello and world", got)
+	}
+	info, err := os.Stat(history.path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 && os.PathSeparator == '/' {
+		t.Errorf("history file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	var lines []string
+	for i := 0; i < chatHistoryMaxLen+10; i++ {
+		lines = append(lines, fmt.Sprintf("prompt %d", i), "")
+	}
+	if err := os.WriteFile(filepath.Join(filepath.Dir(history.path), ChatHistoryFilename), []byte(strings.Join(lines, "\n")), 0600); err != nil {
+		t.Fatal(err)
+	}
+	history = c.loadChatHistory()
+	if history.Len() != chatHistoryMaxLen || history.entries[0] != "prompt 10" {
+		t.Errorf("history has %d entries from %q, want the last %d", history.Len(), history.entries[0], chatHistoryMaxLen)
+	}
+}
@@ -0,0 +1,230 @@
+package cmd
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	CacheDir = "cache"
+	// agentNamesCacheTTL is how long completion uses the cached agent names
+	agentNamesCacheTTL = 2 * time.Minute
+	// agentNamesTimeout is how long completion waits for the server
+	agentNamesTimeout = 5 * time.Second
+)
+
+func newCompletionCmd(c *cli) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "completion [bash|zsh|fish|powershell]",
+		Short: "Generate the shell completion script",
+		Long: `
+Generate the script that completes sia commands, flags and agent names when pressing TAB.
+
+Agent names are fetched from the server with SIA_SERVER_URL, SIA_API_KEY and the saved login, and kept
+for two minutes in ~/.sia/cache.
+
+Bash (needs the bash-completion package):
+  # this shell only
+  source <(sia completion bash)
+  # every new shell, on Linux
+  sia completion bash > /etc/bash_completion.d/sia
+  # every new shell, on macOS with Homebrew
+  sia completion bash > $(brew --prefix)/etc/bash_completion.d/sia
+
+Zsh:
+  # enable completion once, if it is not already
+  echo "autoload -U compinit; compinit" >> ~/.zshrc
+  # every new shell
+  sia completion zsh > "${fpath[1]}/_sia"
+
+Fish:
+  # this shell only
+  sia completion fish | source
+  # every new shell
+  sia completion fish > ~/.config/fish/completions/sia.fish
+
+PowerShell:
+  # this shell only
+  sia completion powershell | Out-String | Invoke-Expression
+  # every new shell, add the line above to the profile shown by
+  echo $PROFILE
+
+Start a new shell after installing the script.`,
+		ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+		Args:                  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+		DisableFlagsInUseLine: true,
+
+		// generating the script does not talk to a SIA server
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+		Run: func(cmd *cobra.Command, args []string) {
+			var err error
+			switch args[0] {
+			case "bash":
+				err = cmd.Root().GenBashCompletionV2(c.stdout, true)
+			case "zsh":
+				err = cmd.Root().GenZshCompletion(c.stdout)
+			case "fish":
+				err = cmd.Root().GenFishCompletion(c.stdout, true)
+			case "powershell":
+				err = cmd.Root().GenPowerShellCompletionWithDesc(c.stdout)
+			}
+			if err != nil {
+				c.handleErr(err, "Failed to generate the completion script")
+			}
+		},
+	}
+
+	return cmd
+}
+
+// isCompletionRequest reports whether cobra is asking for completions, when
+// errors must not be printed as they would be shown as completions
+func isCompletionRequest(cmd *cobra.Command) bool {
+	return cmd.Name() == cobra.ShellCompRequestCmd || cmd.Name() == cobra.ShellCompNoDescRequestCmd
+}
+
+// completeAgentNames completes a flag or argument with the agents on the
+// server. Nothing is completed when the server cannot be reached
+func (c *cli) completeAgentNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	names, err := c.agentNames()
+	if err != nil {
+		cobra.CompDebugln(fmt.Sprintf("cannot complete agent names: %v", err), false)
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	var matches []string
+	for _, name := range names {
+		if strings.HasPrefix(name, toComplete) {
+			matches = append(matches, name)
+		}
+	}
+	return matches, cobra.ShellCompDirectiveNoFileComp
+}
+
+// agentNamesCache is the layout of the files in ~/.sia/cache
+type agentNamesCache struct {
+	ServerURL string    `json:"server_url"`
+	FetchedAt time.Time `json:"fetched_at"`
+	Names     []string  `json:"names"`
+}
+
+// agentNames returns the names of the agents from the cache or, when it is
+// older than agentNamesCacheTTL, from the server. It never exits
+func (c *cli) agentNames() ([]string, error) {
+	serverURL := c.getenv("SIA_SERVER_URL")
+	if serverURL == "" {
+		return nil, fmt.Errorf("SIA_SERVER_URL is not set")
+	}
+	cachePath, err := c.agentNamesCachePath(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	if data, err := os.ReadFile(cachePath); err == nil {
+		var cache agentNamesCache
+		if json.Unmarshal(data, &cache) == nil && cache.ServerURL == serverURL && time.Since(cache.FetchedAt) < agentNamesCacheTTL {
+			return cache.Names, nil
+		}
+	}
+
+	names, err := c.fetchAgentNames(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	c.saveAgentNames(names)
+	return names, nil
+}
+
+// fetchAgentNames lists the agents without the retries and exits of the
+// other commands, so that completion stays quick and quiet
+func (c *cli) fetchAgentNames(serverURL string) ([]string, error) {
+	accessToken, err := c.readAccessToken()
+	if err != nil {
+		return nil, err
+	}
+	if accessToken == "" {
+		return nil, fmt.Errorf("not logged in")
+	}
+
+	apiKey, err := c.lookupAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(c.ctx, agentNamesTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, serverURL+"/api/agents/", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Requested-With", apiKey)
+	req.AddCookie(&http.Cookie{Name: "access_token", Value: accessToken})
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, newAPIError(res, body)
+	}
+
+	var agents []AgentResponse
+	if err := json.Unmarshal(body, &agents); err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(agents))
+	for _, agent := range agents {
+		names = append(names, agent.Name)
+	}
+	return names, nil
+}
+
+// saveAgentNames caches the agent names of the server for completion.
+// Failing to write the cache is not an error
+func (c *cli) saveAgentNames(names []string) {
+	serverURL := c.getenv("SIA_SERVER_URL")
+	cachePath, err := c.agentNamesCachePath(serverURL)
+	if err != nil {
+		return
+	}
+	data, err := json.Marshal(agentNamesCache{ServerURL: serverURL, FetchedAt: time.Now(), Names: names})
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0700); err != nil {
+		return
+	}
+	os.WriteFile(cachePath, data, 0600)
+}
+
+// forgetAgentNames drops the cached agent names after an agent was created
+// or deleted
+func (c *cli) forgetAgentNames() {
+	if cachePath, err := c.agentNamesCachePath(c.getenv("SIA_SERVER_URL")); err == nil {
+		os.Remove(cachePath)
+	}
+}
+
+// agentNamesCachePath returns the cache file of the server, named after a
+// hash of its URL
+func (c *cli) agentNamesCachePath(serverURL string) (string, error) {
+	homeDir, err := c.userHomeDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(serverURL))
+	return filepath.Join(homeDir, TokenDir, CacheDir, "agents-"+hex.EncodeToString(sum[:8])+".json"), nil
+}
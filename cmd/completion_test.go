@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// TestCompleteAgentNamesQuietly completes agent names when the API key
+// would come from a failing credential helper. Completion runs on every TAB,
+// so it must complete nothing instead of running the helper or exiting
+func TestCompleteAgentNamesQuietly(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the credential helper is a shell script")
+	}
+	home := t.TempDir()
+	siaDir := filepath.Join(home, TokenDir)
+	if err := os.Mkdir(siaDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	// the helper leaves a file behind when it is run
+	marker := filepath.Join(home, "helper-ran")
+	helper := filepath.Join(home, "helper.sh")
+	if err := os.WriteFile(helper, []byte("#!/bin/sh\ntouch "+marker+"\nexit 1\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	config := "profiles:\n  default:\n    credential_helper: " + helper + "\n"
+	if err := os.WriteFile(filepath.Join(siaDir, ConfigFilename), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(siaDir, TokenFilename), []byte("saved-token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	result := runInProcess(runOptions{
+		args: []string{"__complete", "agent", "view", ""},
+		env:  map[string]string{"HOME": home, "USERPROFILE": home, "SIA_SERVER_URL": "http://127.0.0.1:1"},
+	})
+
+	if result.exitCode != 0 {
+		t.Errorf("exit code = %d, want 0\n%s", result.exitCode, result)
+	}
+	if result.stdout != ":4\n" {
+		t.Errorf("stdout = %q, want only the directive :4", result.stdout)
+	}
+	if strings.Contains(result.stdout, "Error") {
+		t.Errorf("completion printed an error:\n%s", result)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("completion ran the credential helper")
+	}
+}
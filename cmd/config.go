@@ -0,0 +1,186 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	ConfigFilename = "config.yaml"
+	DefaultProfile = "default"
+)
+
+// Profile holds the settings of one profile in ~/.sia/config.yaml
+type Profile struct {
+	Retries            int           `yaml:"retries"`
+	RetryMaxWait       time.Duration `yaml:"retry_max_wait"`
+	RetryNonIdempotent bool          `yaml:"retry_non_idempotent"`
+	Timeout            time.Duration `yaml:"timeout"`
+
+	// TLS settings for servers behind an internal CA or requiring mutual TLS
+	CAFile                string `yaml:"ca_file"`
+	ClientCert            string `yaml:"client_cert"`
+	ClientKey             string `yaml:"client_key"`
+	TLSServerName         string `yaml:"tls_server_name"`
+	InsecureSkipTLSVerify bool   `yaml:"insecure_skip_tls_verify"`
+
+	// where the access token is kept: plaintext, keyring or encrypted-file
+	CredentialStore string `yaml:"credential_store"`
+
+	// path of the executable asked for the API key, admin password or token
+	// when they are not in the environment, see credential_helper.go. It is
+	// run without arguments
+	CredentialHelper string `yaml:"credential_helper"`
+
+	// local checks of new admin passwords in setpwd and changepwd
+	PasswordPolicy PasswordPolicy `yaml:"password_policy"`
+}
+
+// SiaConfig is the layout of ~/.sia/config.yaml:
+//
+//	profiles:
+//	  default:
+//	    retries: 3
+//	    retry_max_wait: 10s
+type SiaConfig struct {
+	Profiles map[string]yaml.Node `yaml:"profiles"`
+}
+
+// defaultProfile returns the settings used when the config does not set them
+func defaultProfile() Profile {
+	return Profile{
+		Retries:         3,
+		RetryMaxWait:    10 * time.Second,
+		CredentialStore: CredentialStorePlaintext,
+		PasswordPolicy:  defaultPasswordPolicy(),
+	}
+}
+
+// addConfigFlags adds the flags that override the settings of the profile
+func (c *cli) addConfigFlags(cmd *cobra.Command) {
+	// the defaults are only shown in the help, initConfig applies the flags
+	// that are given on top of the profile
+	defaults := defaultProfile()
+	cmd.PersistentFlags().StringVar(&c.profileName, "profile", "", "Profile in ~/.sia/config.yaml to use (default $SIA_PROFILE or \"default\")")
+	cmd.PersistentFlags().Int("retries", defaults.Retries, "Number of times to retry failed idempotent requests")
+	cmd.PersistentFlags().Duration("retry-max-wait", defaults.RetryMaxWait, "Longest wait between retries")
+	cmd.PersistentFlags().Bool("retry-non-idempotent", false, "Also retry POST and PUT requests whose body can be resent")
+	cmd.PersistentFlags().Duration("timeout", defaults.Timeout, "Timeout of each request, 0 for the defaults of 30s, 5m for chat and 15m for uploads")
+	cmd.PersistentFlags().String("ca-file", "", "PEM file with the CA certificates to trust for the SIA server")
+	cmd.PersistentFlags().String("client-cert", "", "PEM file with the client certificate for mutual TLS")
+	cmd.PersistentFlags().String("client-key", "", "PEM file with the key of the client certificate")
+	cmd.PersistentFlags().String("tls-server-name", "", "Server name to verify the certificate against instead of the URL host")
+	cmd.PersistentFlags().Bool("insecure-skip-tls-verify", false, "Do not verify the server certificate (insecure, for testing only)")
+}
+
+// initConfig loads the active profile and applies the flags on top of it
+func (c *cli) initConfig(cmd *cobra.Command) {
+	if c.profileName == "" {
+		c.profileName = c.getenv("SIA_PROFILE")
+	}
+	if c.profileName == "" {
+		c.profileName = DefaultProfile
+	}
+
+	loaded, err := c.loadProfile(c.profileName)
+	if err != nil {
+		// completion goes on with the defaults, the next command reports the error
+		if c.completing {
+			return
+		}
+		c.handleErr(err, "Failed to load ~/.sia/config.yaml")
+	}
+	c.profile = loaded
+
+	// flags given on the command line win over the config file
+	flags := cmd.Root().PersistentFlags()
+	if flags.Changed("retries") {
+		c.profile.Retries, _ = flags.GetInt("retries")
+	}
+	if flags.Changed("retry-max-wait") {
+		c.profile.RetryMaxWait, _ = flags.GetDuration("retry-max-wait")
+	}
+	if flags.Changed("retry-non-idempotent") {
+		c.profile.RetryNonIdempotent, _ = flags.GetBool("retry-non-idempotent")
+	}
+	if flags.Changed("timeout") {
+		c.profile.Timeout, _ = flags.GetDuration("timeout")
+	}
+	if flags.Changed("ca-file") {
+		c.profile.CAFile, _ = flags.GetString("ca-file")
+	}
+	if flags.Changed("client-cert") {
+		c.profile.ClientCert, _ = flags.GetString("client-cert")
+	}
+	if flags.Changed("client-key") {
+		c.profile.ClientKey, _ = flags.GetString("client-key")
+	}
+	if flags.Changed("tls-server-name") {
+		c.profile.TLSServerName, _ = flags.GetString("tls-server-name")
+	}
+	if flags.Changed("insecure-skip-tls-verify") {
+		c.profile.InsecureSkipTLSVerify, _ = flags.GetBool("insecure-skip-tls-verify")
+	}
+
+	if c.profile.InsecureSkipTLSVerify {
+		fmt.Fprintln(c.stderr, "WARNING: TLS certificate verification is disabled. Anyone on the network path can read and change the traffic to the SIA server, including your password and API key.")
+	}
+
+	c.initDebugHTTP()
+	c.initCassette()
+
+	// rebuild the shared client with the TLS and debug settings
+	c.httpClient = c.newHttpClient(defaultMaxConnsPerHost)
+}
+
+// configFilePath returns the path of ~/.sia/config.yaml
+func (c *cli) configFilePath() (string, error) {
+	homeDir, err := c.userHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, TokenDir, ConfigFilename), nil
+}
+
+// loadProfile reads the named profile, falling back to the defaults when
+// there is no config file. Unknown profiles are an error unless "default"
+func (c *cli) loadProfile(name string) (Profile, error) {
+	loaded := defaultProfile()
+
+	configPath, err := c.configFilePath()
+	if err != nil {
+		return loaded, err
+	}
+	data, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) {
+		if name != DefaultProfile {
+			return loaded, fmt.Errorf("profile %s not found, there is no %s", name, configPath)
+		}
+		return loaded, nil
+	}
+	if err != nil {
+		return loaded, err
+	}
+
+	var config SiaConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return loaded, err
+	}
+	node, ok := config.Profiles[name]
+	if !ok {
+		if name != DefaultProfile {
+			return loaded, fmt.Errorf("profile %s not found in %s", name, configPath)
+		}
+		return loaded, nil
+	}
+	// decode over the defaults so that missing settings keep them
+	if err := node.Decode(&loaded); err != nil {
+		return loaded, fmt.Errorf("invalid profile %s: %w", name, err)
+	}
+	return loaded, nil
+}
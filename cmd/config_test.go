@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestConfigFlags checks the flags given win over the profile, also when
+// they are set to their defaults, and the others leave it alone
+func TestConfigFlags(t *testing.T) {
+	home := t.TempDir()
+	siaDir := filepath.Join(home, TokenDir)
+	if err := os.Mkdir(siaDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	config := "profiles:\n  default:\n    retries: 5\n    retry_max_wait: 1m\n    timeout: 2m\n"
+	if err := os.WriteFile(filepath.Join(siaDir, ConfigFilename), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name         string
+		args         []string
+		retries      int
+		retryMaxWait time.Duration
+		timeout      time.Duration
+	}{
+		{"profile", nil, 5, time.Minute, 2 * time.Minute},
+		{"flags", []string{"--retries", "1", "--retry-max-wait", "2s", "--timeout", "3s"}, 1, 2 * time.Second, 3 * time.Second},
+		{"defaults", []string{"--retries", "3", "--retry-max-wait", "10s", "--timeout", "0"}, 3, 10 * time.Second, 0},
+		{"no retries", []string{"--retries", "0"}, 0, time.Minute, 2 * time.Minute},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := newTestCLI(t, map[string]string{"HOME": home, "USERPROFILE": home})
+			root := newRootCmd(c)
+			if err := root.PersistentFlags().Parse(test.args); err != nil {
+				t.Fatal(err)
+			}
+			c.initConfig(root)
+
+			if c.profile.Retries != test.retries {
+				t.Errorf("retries = %d, want %d", c.profile.Retries, test.retries)
+			}
+			if c.profile.RetryMaxWait != test.retryMaxWait {
+				t.Errorf("retry max wait = %s, want %s", c.profile.RetryMaxWait, test.retryMaxWait)
+			}
+			if c.profile.Timeout != test.timeout {
+				t.Errorf("timeout = %s, want %s", c.profile.Timeout, test.timeout)
+			}
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Kinds of secrets a credential helper is asked for
+const (
+	CredentialKindAPIKey   = "api_key"
+	CredentialKindPassword = "password"
+	CredentialKindToken    = "token"
+)
+
+// credentialHelperTimeout is how long a helper has to answer
+const credentialHelperTimeout = 30 * time.Second
+
+// CredentialHelperRequest is written as JSON to the stdin of the helper
+type CredentialHelperRequest struct {
+	ServerURL string `json:"server_url"`
+	Kind      string `json:"kind"`
+	Profile   string `json:"profile"`
+}
+
+// CredentialHelperResponse is read as JSON from the stdout of the helper.
+// An empty secret means the helper has none of that kind
+type CredentialHelperResponse struct {
+	Secret string `json:"secret"`
+}
+
+// runCredentialHelper asks the credential_helper of the profile for a secret.
+// It returns "" without an error when no helper is set or it has no secret
+func (c *cli) runCredentialHelper(kind string) (string, error) {
+	// the setting is the path of one executable, which may have spaces as
+	// in C:\Program Files or ~/My Tools, so it is not split into arguments
+	helperPath := strings.TrimSpace(c.profile.CredentialHelper)
+	// the helper may prompt, which completion must not do on every TAB
+	if helperPath == "" || c.completing {
+		return "", nil
+	}
+	if strings.HasPrefix(helperPath, "~") {
+		helperPath = c.resolvePath(helperPath)
+	}
+
+	request, err := json.Marshal(CredentialHelperRequest{
+		ServerURL: c.getenv("SIA_SERVER_URL"),
+		Kind:      kind,
+		Profile:   c.profileName,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(c.ctx, credentialHelperTimeout)
+	defer cancel()
+	helper := exec.CommandContext(ctx, helperPath)
+	helper.Stdin = bytes.NewReader(append(request, '\n'))
+	// the helper may prompt or explain failures on stderr
+	helper.Stderr = c.stderr
+	output, err := helper.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", fmt.Errorf("credential helper %s did not answer within %s", helperPath, credentialHelperTimeout)
+	}
+	if err != nil {
+		return "", fmt.Errorf("credential helper %s failed: %w", helperPath, err)
+	}
+
+	output = bytes.TrimSpace(output)
+	if len(output) == 0 {
+		return "", nil
+	}
+	var response CredentialHelperResponse
+	if err := json.Unmarshal(output, &response); err != nil {
+		return "", fmt.Errorf("credential helper %s returned invalid JSON: %w", helperPath, err)
+	}
+	return response.Secret, nil
+}
+
+// resolveAPIKey returns SIA_API_KEY or, when it is not set, the API key from
+// the credential helper or the credential store
+func (c *cli) resolveAPIKey() string {
+	apiKey, err := c.lookupAPIKey()
+	if err != nil {
+		c.handleErr(err, "Failed to get the API key")
+	}
+	return apiKey
+}
+
+// lookupAPIKey is resolveAPIKey for callers that must not exit, such as the
+// servers and shell completion
+func (c *cli) lookupAPIKey() (string, error) {
+	c.apiKeyOnce.Do(func() {
+		if apiKey := c.getenv("SIA_API_KEY"); apiKey != "" {
+			c.apiKey = apiKey
+			return
+		}
+		apiKey, err := c.runCredentialHelper(CredentialKindAPIKey)
+		if err != nil {
+			c.apiKeyErr = err
+			return
+		}
+		if apiKey == "" {
+			// saved with 'sia auth migrate --api-key'
+			store, err := c.activeCredentialStore()
+			if err != nil {
+				c.apiKeyErr = err
+				return
+			}
+			stored, err := store.Get(credentialAPIKey)
+			if err != nil && !errors.Is(err, errCredentialNotFound) {
+				c.apiKeyErr = err
+				return
+			}
+			apiKey = stored
+		}
+		c.apiKey = strings.TrimSpace(apiKey)
+	})
+	return c.apiKey, c.apiKeyErr
+}
+
+// adminPasswordFromEnv returns SIA_ADMIN_PASSWORD or the password from the
+// credential helper, and where it came from, or "" when neither has one
+func (c *cli) adminPasswordFromEnv() (password, source string) {
+	if password := c.getenv("SIA_ADMIN_PASSWORD"); password != "" {
+		return password, "SIA_ADMIN_PASSWORD"
+	}
+	password, err := c.runCredentialHelper(CredentialKindPassword)
+	if err != nil {
+		c.handleErr(err, "Failed to get the admin password")
+	}
+	if password == "" {
+		return "", ""
+	}
+	return password, "the credential helper"
+}
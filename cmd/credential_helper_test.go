@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"sia-cli/internal/fakeserver"
+)
+
+// credentialHelperModeEnv makes the test binary act as a credential helper
+const credentialHelperModeEnv = "SIA_TEST_CREDENTIAL_HELPER"
+
+func TestMain(m *testing.M) {
+	if mode := os.Getenv(credentialHelperModeEnv); mode != "" {
+		os.Exit(fakeCredentialHelper(mode))
+	}
+	os.Exit(m.Run())
+}
+
+// fakeCredentialHelper answers a request as the mode says: with a secret,
+// with the request itself as the secret, with nothing, with invalid JSON, or
+// by failing
+func fakeCredentialHelper(mode string) int {
+	request, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	switch mode {
+	case "secret":
+		fmt.Println(`{"secret": "helper-secret"}`)
+	case "echo":
+		response, _ := json.Marshal(CredentialHelperResponse{Secret: strings.TrimSpace(string(request))})
+		fmt.Println(string(response))
+	case "empty":
+	case "invalid":
+		fmt.Println("helper-secret")
+	case "fail":
+		fmt.Fprintln(os.Stderr, "no secrets here")
+		return 1
+	}
+	return 0
+}
+
+// newHelperTestCLI returns a run whose credential helper is the test binary,
+// linked from a directory with a space in its name
+func newHelperTestCLI(t *testing.T, mode string, env map[string]string) *cli {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the helper is a symbolic link to the test binary")
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(t.TempDir(), "My Tools")
+	if err := os.Mkdir(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	helper := filepath.Join(dir, "sia-creds")
+	if err := os.Symlink(executable, helper); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(credentialHelperModeEnv, mode)
+
+	runEnv := map[string]string{"SIA_SERVER_URL": "https://sia.example.com"}
+	for key, value := range env {
+		runEnv[key] = value
+	}
+	c := newTestCLI(t, runEnv)
+	c.profileName = "work"
+	c.profile.CredentialHelper = helper
+	return c
+}
+
+// TestRunCredentialHelper checks the JSON protocol with the helper
+func TestRunCredentialHelper(t *testing.T) {
+	tests := []struct {
+		mode    string
+		want    string
+		wantErr string
+	}{
+		{mode: "secret", want: "helper-secret"},
+		{mode: "empty", want: ""},
+		{mode: "invalid", wantErr: "returned invalid JSON"},
+		{mode: "fail", wantErr: "failed: exit status 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			c := newHelperTestCLI(t, tt.mode, nil)
+			got, err := c.runCredentialHelper(CredentialKindAPIKey)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("secret = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestCredentialHelperRequest checks the request the helper is sent
+func TestCredentialHelperRequest(t *testing.T) {
+	c := newHelperTestCLI(t, "echo", nil)
+	sent, err := c.runCredentialHelper(CredentialKindPassword)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var request CredentialHelperRequest
+	if err := json.Unmarshal([]byte(sent), &request); err != nil {
+		t.Fatalf("the request %q is not JSON: %v", sent, err)
+	}
+	want := CredentialHelperRequest{ServerURL: "https://sia.example.com", Kind: CredentialKindPassword, Profile: "work"}
+	if request != want {
+		t.Errorf("request = %+v, want %+v", request, want)
+	}
+}
+
+// TestAdminPasswordFromEnv checks the password is taken from the environment
+// before the credential helper and that its source is named
+func TestAdminPasswordFromEnv(t *testing.T) {
+	c := newHelperTestCLI(t, "secret", map[string]string{"SIA_ADMIN_PASSWORD": "env-secret"})
+	if password, source := c.adminPasswordFromEnv(); password != "env-secret" || source != "SIA_ADMIN_PASSWORD" {
+		t.Errorf("adminPasswordFromEnv = %q, %q, want the password from SIA_ADMIN_PASSWORD", password, source)
+	}
+
+	c = newHelperTestCLI(t, "secret", nil)
+	if password, source := c.adminPasswordFromEnv(); password != "helper-secret" || source != "the credential helper" {
+		t.Errorf("adminPasswordFromEnv = %q, %q, want the password from the credential helper", password, source)
+	}
+
+	c = newHelperTestCLI(t, "empty", nil)
+	if password, source := c.adminPasswordFromEnv(); password != "" || source != "" {
+		t.Errorf("adminPasswordFromEnv = %q, %q, want nothing", password, source)
+	}
+}
+
+// TestSessionReloginWithCredentialHelper checks an expired session is
+// renewed with the password from the credential helper, and says so
+func TestSessionReloginWithCredentialHelper(t *testing.T) {
+	server := fakeserver.New(fakeserver.Options{APIKey: "test-key", AdminPassword: "helper-secret"})
+	server.AddAgent(fakeserver.Agent{Name: "kb"})
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	c := newHelperTestCLI(t, "secret", map[string]string{"SIA_SERVER_URL": ts.URL, "SIA_API_KEY": "test-key"})
+	c.loginWithPassword("helper-secret")
+	server.ExpireSessions()
+
+	var out strings.Builder
+	c.stdout = &out
+	res, body := c.executeHttpRequest(c.createAuthHttpClient("GET", "/api/agents/", nil, ""))
+	if res.StatusCode != 200 {
+		t.Errorf("status = %s after logging in again: %s", res.Status, body)
+	}
+	want := "Your session has expired.\nLogging in again with the password from the credential helper.\n"
+	if out.String() != want {
+		t.Errorf("stdout = %q, want %q", out.String(), want)
+	}
+}
+
+// TestCredentialHelperNotSet checks nothing is run without a helper
+func TestCredentialHelperNotSet(t *testing.T) {
+	c := newTestCLI(t, nil)
+	c.profile.CredentialHelper = "  "
+	secret, err := c.runCredentialHelper(CredentialKindToken)
+	if secret != "" || err != nil {
+		t.Errorf("runCredentialHelper = %q, %v, want nothing", secret, err)
+	}
+}
@@ -0,0 +1,389 @@
+package cmd
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Names of the credential stores, set with credential_store in a profile
+const (
+	CredentialStorePlaintext     = "plaintext"
+	CredentialStoreKeyring       = "keyring"
+	CredentialStoreEncryptedFile = "encrypted-file"
+)
+
+// Keys of the secrets kept in the credential store
+const (
+	credentialAccessToken = "access_token"
+	credentialTokenServer = "access_token_server"
+	credentialAPIKey      = "api_key"
+)
+
+const (
+	CredentialsFilename = "credentials.enc"
+	APIKeyFilename      = ".api_key"
+	keyringService      = "sia-cli"
+)
+
+// errCredentialNotFound is returned by Get when the store has no such secret
+var errCredentialNotFound = errors.New("credential not found")
+
+// CredentialStore keeps the access token and other secrets of the CLI
+type CredentialStore interface {
+	Name() string
+	Get(key string) (string, error)
+	Set(key, value string) error
+	Delete(key string) error
+}
+
+// credentialStore returns the store selected by the active profile
+func (c *cli) credentialStore() CredentialStore {
+	store, err := c.activeCredentialStore()
+	if err != nil {
+		c.handleErr(err, "Failed to open the credential store")
+	}
+	return store
+}
+
+// activeCredentialStore is credentialStore for callers that must not exit
+func (c *cli) activeCredentialStore() (CredentialStore, error) {
+	// replayed commands must not touch the saved login
+	if c.httpCassette != nil && c.httpCassette.replaying {
+		c.credentialMu.Lock()
+		defer c.credentialMu.Unlock()
+		if c.httpCassette.store == nil {
+			c.httpCassette.store = newReplayStore(c.getenv("SIA_SERVER_URL"))
+		}
+		return c.httpCassette.store, nil
+	}
+	return c.openCredentialStore(c.profile.CredentialStore)
+}
+
+// openCredentialStore returns the named store
+func (c *cli) openCredentialStore(name string) (CredentialStore, error) {
+	c.credentialMu.Lock()
+	defer c.credentialMu.Unlock()
+	if store, ok := c.credentialStores[name]; ok {
+		return store, nil
+	}
+
+	homeDir, err := c.userHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	siaDir := filepath.Join(homeDir, TokenDir)
+
+	var store CredentialStore
+	switch name {
+	case CredentialStorePlaintext, "":
+		store = &plaintextStore{dir: siaDir}
+	case CredentialStoreKeyring:
+		store = &keyringStore{service: keyringService}
+	case CredentialStoreEncryptedFile:
+		store = &encryptedFileStore{
+			path:       filepath.Join(siaDir, CredentialsFilename),
+			passphrase: c.readCredentialsPassphrase,
+		}
+	default:
+		return nil, fmt.Errorf("unknown credential_store %q, use %s, %s or %s", name,
+			CredentialStorePlaintext, CredentialStoreKeyring, CredentialStoreEncryptedFile)
+	}
+	c.credentialStores[name] = store
+	return store, nil
+}
+
+// plaintextStore keeps each secret in its own file in ~/.sia, readable only
+// by the user. It is meant for headless servers without a keyring
+type plaintextStore struct {
+	dir string
+}
+
+// plaintextFilenames are the files of the secrets, as saved by earlier versions
+var plaintextFilenames = map[string]string{
+	credentialAccessToken: TokenFilename,
+	credentialTokenServer: TokenServerFilename,
+	credentialAPIKey:      APIKeyFilename,
+}
+
+func (s *plaintextStore) Name() string { return CredentialStorePlaintext }
+
+func (s *plaintextStore) path(key string) string {
+	return filepath.Join(s.dir, plaintextFilenames[key])
+}
+
+func (s *plaintextStore) Get(key string) (string, error) {
+	value, err := os.ReadFile(s.path(key))
+	if os.IsNotExist(err) {
+		return "", errCredentialNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(value), nil
+}
+
+func (s *plaintextStore) Set(key, value string) error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(s.path(key), []byte(value), 0600)
+}
+
+func (s *plaintextStore) Delete(key string) error {
+	err := os.Remove(s.path(key))
+	if os.IsNotExist(err) {
+		return errCredentialNotFound
+	}
+	return err
+}
+
+// keyringStore keeps the secrets in the keyring of the OS: the Secret Service
+// over D-Bus on Linux, the Keychain on macOS and the Credential Manager on Windows
+type keyringStore struct {
+	service string
+}
+
+func (s *keyringStore) Name() string { return CredentialStoreKeyring }
+
+func (s *keyringStore) Get(key string) (string, error) {
+	value, err := keyring.Get(s.service, key)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", errCredentialNotFound
+	}
+	if err != nil {
+		return "", keyringError(err)
+	}
+	return value, nil
+}
+
+func (s *keyringStore) Set(key, value string) error {
+	if err := keyring.Set(s.service, key, value); err != nil {
+		return keyringError(err)
+	}
+	return nil
+}
+
+func (s *keyringStore) Delete(key string) error {
+	err := keyring.Delete(s.service, key)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return errCredentialNotFound
+	}
+	if err != nil {
+		return keyringError(err)
+	}
+	return nil
+}
+
+// keyringError explains what to do when there is no keyring, e.g. on a
+// server without a desktop session
+func keyringError(err error) error {
+	return fmt.Errorf("the OS keyring is not available (%w). Use credential_store: %s or %s in ~/.sia/config.yaml instead",
+		err, CredentialStoreEncryptedFile, CredentialStorePlaintext)
+}
+
+// encryptedFileStore keeps the secrets in ~/.sia/credentials.enc, encrypted
+// with AES-256-GCM under a key derived from a passphrase with scrypt
+type encryptedFileStore struct {
+	path string
+	// passphrase asks for the passphrase, twice when creating the file
+	passphrase func(create bool) (string, error)
+
+	mu      sync.Mutex        // guards the fields below
+	secrets map[string]string // nil until the file is read
+	salt    []byte
+	key     []byte
+}
+
+// encryptedCredentials is the layout of credentials.enc
+type encryptedCredentials struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// scrypt parameters recommended for interactive logins
+const (
+	scryptN      = 1 << 15
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+)
+
+func (s *encryptedFileStore) Name() string { return CredentialStoreEncryptedFile }
+
+func (s *encryptedFileStore) Get(key string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return "", err
+	}
+	value, ok := s.secrets[key]
+	if !ok {
+		return "", errCredentialNotFound
+	}
+	return value, nil
+}
+
+func (s *encryptedFileStore) Set(key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	s.secrets[key] = value
+	return s.save()
+}
+
+func (s *encryptedFileStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.load(); err != nil {
+		return err
+	}
+	if _, ok := s.secrets[key]; !ok {
+		return errCredentialNotFound
+	}
+	delete(s.secrets, key)
+	return s.save()
+}
+
+// load decrypts the file, asking for the passphrase. A missing file is empty
+func (s *encryptedFileStore) load() error {
+	if s.secrets != nil {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		s.secrets = map[string]string{}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var file encryptedCredentials
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("%s is damaged: %w", s.path, err)
+	}
+	if file.Version != 1 || file.KDF != "scrypt" {
+		return fmt.Errorf("%s was written by a newer version of sia", s.path)
+	}
+	passphrase, err := s.passphrase(false)
+	if err != nil {
+		return err
+	}
+	key, err := scrypt.Key([]byte(passphrase), file.Salt, scryptN, scryptR, scryptP, scryptKeyLen)
+	if err != nil {
+		return err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+	plaintext, err := gcm.Open(nil, file.Nonce, file.Data, nil)
+	if err != nil {
+		return fmt.Errorf("wrong passphrase for %s", s.path)
+	}
+	secrets := map[string]string{}
+	if err := json.Unmarshal(plaintext, &secrets); err != nil {
+		return fmt.Errorf("%s is damaged: %w", s.path, err)
+	}
+	s.secrets, s.salt, s.key = secrets, file.Salt, key
+	return nil
+}
+
+// save encrypts the secrets with a new nonce and replaces the file
+func (s *encryptedFileStore) save() error {
+	if s.key == nil {
+		passphrase, err := s.passphrase(true)
+		if err != nil {
+			return err
+		}
+		s.salt = make([]byte, 16)
+		if _, err := rand.Read(s.salt); err != nil {
+			return err
+		}
+		s.key, err = scrypt.Key([]byte(passphrase), s.salt, scryptN, scryptR, scryptP, scryptKeyLen)
+		if err != nil {
+			return err
+		}
+	}
+
+	gcm, err := newGCM(s.key)
+	if err != nil {
+		return err
+	}
+	plaintext, err := json.Marshal(s.secrets)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(encryptedCredentials{
+		Version: 1,
+		KDF:     "scrypt",
+		Salt:    s.salt,
+		Nonce:   nonce,
+		Data:    gcm.Seal(nil, nonce, plaintext, nil),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write next to the file and rename so it is never half written
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return err
+	}
+	tempPath := s.path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, s.path)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// readCredentialsPassphrase takes the passphrase of credentials.enc from
+// SIA_CREDENTIALS_PASSPHRASE or asks for it, twice when creating the file
+func (c *cli) readCredentialsPassphrase(create bool) (string, error) {
+	if passphrase := c.getenv("SIA_CREDENTIALS_PASSPHRASE"); passphrase != "" {
+		return passphrase, nil
+	}
+	if c.completing {
+		return "", errors.New("the passphrase of ~/.sia/credentials.enc is not asked for during completion. Set SIA_CREDENTIALS_PASSPHRASE")
+	}
+	if !c.isInteractive() {
+		return "", errors.New("no terminal to ask for the passphrase of ~/.sia/credentials.enc. Set SIA_CREDENTIALS_PASSPHRASE")
+	}
+	if !create {
+		return c.readHiddenTextInput("Enter the passphrase of ~/.sia/credentials.enc: "), nil
+	}
+	passphrase := c.readHiddenTextInput("Choose a passphrase for ~/.sia/credentials.enc: ")
+	if passphrase == "" {
+		return "", errors.New("the passphrase must not be empty")
+	}
+	if c.readHiddenTextInput("Repeat the passphrase: ") != passphrase {
+		return "", errors.New("the passphrases do not match")
+	}
+	return passphrase, nil
+}
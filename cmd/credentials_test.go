@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestEncryptedStore returns a store of the file at path unlocked with passphrase
+func newTestEncryptedStore(path, passphrase string) *encryptedFileStore {
+	return &encryptedFileStore{
+		path:       path,
+		passphrase: func(create bool) (string, error) { return passphrase, nil },
+	}
+}
+
+// TestEncryptedFileStore saves secrets and reads them back with a new store,
+// as the next command does
+func TestEncryptedFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".sia", CredentialsFilename)
+	store := newTestEncryptedStore(path, "correct horse")
+	if _, err := store.Get(credentialAccessToken); !errors.Is(err, errCredentialNotFound) {
+		t.Fatalf("Get from a missing file = %v, want errCredentialNotFound", err)
+	}
+	if err := store.Set(credentialAccessToken, "secret-token"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Set(credentialAPIKey, "secret-key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(credentialAPIKey); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret-token") {
+		t.Error("the file has the token in plain text")
+	}
+	if info, err := os.Stat(path); err == nil && info.Mode().Perm()&0077 != 0 {
+		t.Errorf("the file mode is %v, want it readable only by the user", info.Mode().Perm())
+	}
+
+	reopened := newTestEncryptedStore(path, "correct horse")
+	token, err := reopened.Get(credentialAccessToken)
+	if err != nil || token != "secret-token" {
+		t.Errorf("Get after reopening = %q, %v, want the saved token", token, err)
+	}
+	if _, err := reopened.Get(credentialAPIKey); !errors.Is(err, errCredentialNotFound) {
+		t.Errorf("Get of the deleted key = %v, want errCredentialNotFound", err)
+	}
+	if err := reopened.Delete(credentialAPIKey); !errors.Is(err, errCredentialNotFound) {
+		t.Errorf("Delete of the deleted key = %v, want errCredentialNotFound", err)
+	}
+}
+
+// TestEncryptedFileStoreErrors checks a wrong passphrase and damaged files
+// are reported instead of read as empty, which would lose the secrets
+func TestEncryptedFileStoreErrors(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, CredentialsFilename)
+	if err := newTestEncryptedStore(path, "correct horse").Set(credentialAccessToken, "secret-token"); err != nil {
+		t.Fatal(err)
+	}
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// change the saved file with edit and return the path of the copy
+	damaged := func(name string, edit func(file *encryptedCredentials)) string {
+		var file encryptedCredentials
+		if err := json.Unmarshal(saved, &file); err != nil {
+			t.Fatal(err)
+		}
+		edit(&file)
+		data, err := json.Marshal(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		copyPath := filepath.Join(dir, name)
+		if err := os.WriteFile(copyPath, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return copyPath
+	}
+	notJSON := filepath.Join(dir, "not-json.enc")
+	if err := os.WriteFile(notJSON, saved[:len(saved)/2], 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		path       string
+		passphrase string
+		wantErr    string
+	}{
+		{"wrong passphrase", path, "wrong horse", "wrong passphrase"},
+		{"changed data", damaged("data.enc", func(file *encryptedCredentials) { file.Data[0] ^= 1 }), "correct horse", "wrong passphrase"},
+		{"changed nonce", damaged("nonce.enc", func(file *encryptedCredentials) { file.Nonce[0] ^= 1 }), "correct horse", "wrong passphrase"},
+		{"cut short", notJSON, "correct horse", "is damaged"},
+		{"newer version", damaged("version.enc", func(file *encryptedCredentials) { file.Version = 2 }), "correct horse", "newer version"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestEncryptedStore(tt.path, tt.passphrase)
+			_, err := store.Get(credentialAccessToken)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Get = %v, want an error with %q", err, tt.wantErr)
+			}
+			// a store that could not be read must not be overwritten
+			if err := store.Set(credentialAPIKey, "secret-key"); err == nil {
+				t.Error("Set replaced a file that could not be read")
+			}
+		})
+	}
+}
+
+// TestAuthMigrate moves the saved login from plaintext files into the
+// encrypted file
+func TestAuthMigrate(t *testing.T) {
+	home := t.TempDir()
+	siaDir := filepath.Join(home, TokenDir)
+	if err := os.Mkdir(siaDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{TokenFilename: "secret-token", TokenServerFilename: "https://sia.example.com"} {
+		if err := os.WriteFile(filepath.Join(siaDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result := runInProcess(runOptions{
+		args: []string{"auth", "migrate", "--to", CredentialStoreEncryptedFile, "--api-key"},
+		env: map[string]string{
+			"HOME":                       home,
+			"USERPROFILE":                home,
+			"SIA_SERVER_URL":             "https://sia.example.com",
+			"SIA_API_KEY":                "secret-key",
+			"SIA_CREDENTIALS_PASSPHRASE": "correct horse",
+		},
+	})
+	if result.exitCode != 0 {
+		t.Fatalf("exit code = %d\n%s", result.exitCode, result)
+	}
+	for _, line := range []string{
+		"Saved SIA_API_KEY in encrypted-file.",
+		"Moved access_token from plaintext to encrypted-file.",
+		"Set credential_store: encrypted-file in the default profile",
+	} {
+		if !strings.Contains(result.stdout, line) {
+			t.Errorf("stdout has no %q\n%s", line, result)
+		}
+	}
+
+	for _, name := range []string{TokenFilename, TokenServerFilename} {
+		if _, err := os.Stat(filepath.Join(siaDir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s is still in ~/.sia: %v", name, err)
+		}
+	}
+	store := newTestEncryptedStore(filepath.Join(siaDir, CredentialsFilename), "correct horse")
+	for key, want := range map[string]string{
+		credentialAccessToken: "secret-token",
+		credentialTokenServer: "https://sia.example.com",
+		credentialAPIKey:      "secret-key",
+	} {
+		if got, err := store.Get(key); err != nil || got != want {
+			t.Errorf("%s = %q, %v, want %q", key, got, err, want)
+		}
+	}
+}
+
+// TestAuthMigrateWrongPassphrase keeps the plaintext files when the
+// encrypted file cannot be opened
+func TestAuthMigrateWrongPassphrase(t *testing.T) {
+	home := t.TempDir()
+	siaDir := filepath.Join(home, TokenDir)
+	if err := newTestEncryptedStore(filepath.Join(siaDir, CredentialsFilename), "correct horse").Set(credentialAPIKey, "old-key"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(siaDir, TokenFilename), []byte("secret-token"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	result := runInProcess(runOptions{
+		args: []string{"auth", "migrate", "--to", CredentialStoreEncryptedFile},
+		env: map[string]string{
+			"HOME":                       home,
+			"USERPROFILE":                home,
+			"SIA_SERVER_URL":             "https://sia.example.com",
+			"SIA_API_KEY":                "secret-key",
+			"SIA_CREDENTIALS_PASSPHRASE": "wrong horse",
+		},
+	})
+	if result.exitCode == 0 || !strings.Contains(result.stdout, "wrong passphrase") {
+		t.Errorf("migrating with a wrong passphrase did not fail\n%s", result)
+	}
+	if _, err := os.Stat(filepath.Join(siaDir, TokenFilename)); err != nil {
+		t.Errorf("the plaintext token was removed: %v", err)
+	}
+}
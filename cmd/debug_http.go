@@ -0,0 +1,481 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Levels of -v/--verbose
+const (
+	verboseRequests = 1 // method, URL, status and timing
+	verboseHeaders  = 2 // and the headers
+	verboseBodies   = 3 // and the (truncated) bodies
+)
+
+// debugBodyLimit is how much of a body is printed to stderr
+const debugBodyLimit = 2048
+
+// traceBodyLimit is how much of a body is kept in the trace file
+const traceBodyLimit = 1 << 20
+
+const redacted = "[REDACTED]"
+
+// addDebugFlags adds the flags that log and trace the requests
+func (c *cli) addDebugFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().CountVarP(&c.verbosity, "verbose", "v", "Log requests to stderr: -v for status and timing, -vv to add headers, -vvv to add bodies")
+	cmd.PersistentFlags().BoolVar(&c.debugHTTP, "debug-http", false, "Log every request and response to stderr in full (same as -vvv)")
+	cmd.PersistentFlags().StringVar(&c.traceFile, "trace-file", "", "Write the requests and responses to this file in HAR format")
+}
+
+// initDebugHTTP applies --debug-http and opens the trace file
+func (c *cli) initDebugHTTP() {
+	if c.debugHTTP && c.verbosity < verboseBodies {
+		c.verbosity = verboseBodies
+	}
+	if c.traceFile != "" {
+		trace, err := newHARTrace(c.resolvePath(c.traceFile), c.stderr)
+		if err != nil {
+			c.handleErr(err, "Failed to write the trace file")
+		}
+		c.httpTrace = trace
+	}
+}
+
+// debugTransport logs the requests to stderr and records them in the trace
+// file. API keys, login cookies and passwords are always redacted
+type debugTransport struct {
+	base  http.RoundTripper
+	level int
+	trace *harTrace
+	out   io.Writer
+}
+
+// withDebugTransport wraps the transport when -v, --debug-http or
+// --trace-file is given
+func (c *cli) withDebugTransport(base http.RoundTripper) http.RoundTripper {
+	if c.verbosity <= 0 && c.httpTrace == nil {
+		return base
+	}
+	return &debugTransport{base: base, level: c.verbosity, trace: c.httpTrace, out: c.stderr}
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	readBodies := t.level >= verboseBodies || t.trace != nil
+
+	// read a copy of the request body so the one sent is left untouched
+	var reqBody []byte
+	if readBodies && req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			reqBody, _ = io.ReadAll(body)
+			body.Close()
+		}
+	}
+	reqBody = redactBody(req.Header.Get("Content-Type"), reqBody)
+	reqHeaders := redactHeaders(req.Header)
+	t.logRequest(req, reqHeaders, reqBody)
+
+	start := time.Now()
+	res, err := t.base.RoundTrip(req)
+	wait := time.Since(start)
+	if err != nil {
+		if t.level >= verboseRequests {
+			fmt.Fprintf(t.out, "! %s %s failed after %s: %v\n", req.Method, req.URL, wait.Round(time.Millisecond), err)
+		}
+		t.trace.add(req, reqHeaders, reqBody, nil, nil, nil, start, wait, 0, err)
+		return nil, err
+	}
+
+	// read the response body and hand the caller a copy of it
+	var resBody []byte
+	if readBodies {
+		var readErr error
+		resBody, readErr = io.ReadAll(res.Body)
+		res.Body.Close()
+		var body io.Reader = bytes.NewReader(resBody)
+		if readErr != nil {
+			// pass the read error on to the caller after the data read so far
+			body = io.MultiReader(body, errReader{readErr})
+		}
+		res.Body = io.NopCloser(body)
+	}
+	receive := time.Since(start) - wait
+	shownBody := redactBody(res.Header.Get("Content-Type"), resBody)
+	resHeaders := redactHeaders(res.Header)
+	t.logResponse(req, res, resHeaders, shownBody, wait+receive)
+	t.trace.add(req, reqHeaders, reqBody, res, resHeaders, shownBody, start, wait, receive, nil)
+	return res, nil
+}
+
+func (t *debugTransport) logRequest(req *http.Request, headers http.Header, body []byte) {
+	if t.level < verboseRequests {
+		return
+	}
+	fmt.Fprintf(t.out, "> %s %s\n", req.Method, req.URL)
+	if t.level >= verboseHeaders {
+		printDebugHeaders(t.out, ">", headers)
+	}
+	if t.level >= verboseBodies {
+		printDebugBody(t.out, ">", req.Body != nil && req.Body != http.NoBody && req.GetBody == nil, body)
+	}
+}
+
+func (t *debugTransport) logResponse(req *http.Request, res *http.Response, headers http.Header, body []byte, elapsed time.Duration) {
+	if t.level < verboseRequests {
+		return
+	}
+	fmt.Fprintf(t.out, "< %s %s: %s (%s)\n", req.Method, req.URL, res.Status, elapsed.Round(time.Millisecond))
+	if t.level >= verboseHeaders {
+		printDebugHeaders(t.out, "<", headers)
+	}
+	if t.level >= verboseBodies {
+		printDebugBody(t.out, "<", false, body)
+	}
+}
+
+func printDebugHeaders(out io.Writer, prefix string, headers http.Header) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range headers[name] {
+			fmt.Fprintf(out, "%s %s: %s\n", prefix, name, value)
+		}
+	}
+}
+
+func printDebugBody(out io.Writer, prefix string, streamed bool, body []byte) {
+	if streamed {
+		fmt.Fprintf(out, "%s (streamed body not shown)\n", prefix)
+		return
+	}
+	if len(body) == 0 {
+		return
+	}
+	text, more := truncateBody(body, debugBodyLimit)
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		fmt.Fprintf(out, "%s %s\n", prefix, line)
+	}
+	if more > 0 {
+		fmt.Fprintf(out, "%s ... (%d more bytes)\n", prefix, more)
+	}
+}
+
+// truncateBody returns at most limit bytes of the body and how many were left out
+func truncateBody(body []byte, limit int) (string, int) {
+	if len(body) <= limit {
+		return string(body), 0
+	}
+	return string(body[:limit]), len(body) - limit
+}
+
+// redactHeaders returns a copy of the headers without the API key and the
+// login cookie
+func redactHeaders(headers http.Header) http.Header {
+	clean := headers.Clone()
+	for name, values := range clean {
+		switch http.CanonicalHeaderKey(name) {
+		case "X-Requested-With", "Authorization":
+			for i := range values {
+				values[i] = redacted
+			}
+		case "Cookie":
+			for i, value := range values {
+				values[i] = redactCookies(value)
+			}
+		case "Set-Cookie":
+			for i, value := range values {
+				if strings.HasPrefix(strings.TrimSpace(value), "access_token=") {
+					_, attributes, _ := strings.Cut(value, ";")
+					values[i] = "access_token=" + redacted
+					if attributes != "" {
+						values[i] += ";" + attributes
+					}
+				}
+			}
+		}
+	}
+	return clean
+}
+
+// redactCookies hides the value of the access_token cookie in a Cookie header
+func redactCookies(header string) string {
+	cookies := strings.Split(header, ";")
+	for i, cookie := range cookies {
+		name, _, _ := strings.Cut(strings.TrimSpace(cookie), "=")
+		if name == "access_token" {
+			cookies[i] = strings.Replace(cookie, strings.TrimSpace(cookie), "access_token="+redacted, 1)
+		}
+	}
+	return strings.Join(cookies, ";")
+}
+
+// redactBody hides passwords and tokens in JSON and form bodies, such as the
+// login, setpwd and changepwd payloads
+func redactBody(contentType string, body []byte) []byte {
+	if len(body) == 0 {
+		return body
+	}
+	switch {
+	case strings.Contains(contentType, "json") || json.Valid(body):
+		var value interface{}
+		if err := json.Unmarshal(body, &value); err != nil {
+			return body
+		}
+		if !redactJSON(value) {
+			return body
+		}
+		clean, err := json.Marshal(value)
+		if err != nil {
+			return body
+		}
+		return clean
+	case strings.HasPrefix(contentType, "application/x-www-form-urlencoded"):
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return body
+		}
+		for key := range form {
+			if isSecretField(key) {
+				form.Set(key, redacted)
+			}
+		}
+		return []byte(form.Encode())
+	}
+	return body
+}
+
+// redactJSON replaces secret fields in place and reports whether it found any
+func redactJSON(value interface{}) bool {
+	found := false
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if isSecretField(key) {
+				v[key] = redacted
+				found = true
+				continue
+			}
+			found = redactJSON(field) || found
+		}
+	case []interface{}:
+		for _, item := range v {
+			found = redactJSON(item) || found
+		}
+	}
+	return found
+}
+
+func isSecretField(name string) bool {
+	name = strings.ToLower(name)
+	return strings.Contains(name, "password") || name == "access_token" || name == "api_key"
+}
+
+// errReader returns err once the body read before it is used up
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+// harTrace writes the requests to a HAR 1.2 file. The file is rewritten
+// after every request so it is complete even when the command exits early
+type harTrace struct {
+	mu      sync.Mutex
+	path    string
+	entries []harEntry
+	// failures to write the file are reported here
+	warnings io.Writer
+}
+
+type harFile struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime string      `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Error           string      `json:"_error,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []harNameValue `json:"cookies"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+func newHARTrace(path string, warnings io.Writer) (*harTrace, error) {
+	trace := &harTrace{path: path, warnings: warnings}
+	// fail early when the file cannot be written
+	if err := trace.write(); err != nil {
+		return nil, err
+	}
+	return trace, nil
+}
+
+// add records a request and its response, or the error it failed with
+func (t *harTrace) add(req *http.Request, reqHeaders http.Header, reqBody []byte, res *http.Response, resHeaders http.Header, resBody []byte, start time.Time, wait, receive time.Duration, failure error) {
+	if t == nil {
+		return
+	}
+
+	entry := harEntry{
+		StartedDateTime: start.Format(time.RFC3339Nano),
+		Time:            milliseconds(wait + receive),
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         req.URL.String(),
+			HTTPVersion: req.Proto,
+			Cookies:     []harNameValue{},
+			Headers:     harHeaders(reqHeaders),
+			QueryString: []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    len(reqBody),
+		},
+		Response: harResponse{
+			Cookies:     []harNameValue{},
+			Headers:     []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Timings: harTimings{Send: 0, Wait: milliseconds(wait), Receive: milliseconds(receive)},
+	}
+	for name, values := range req.URL.Query() {
+		for _, value := range values {
+			entry.Request.QueryString = append(entry.Request.QueryString, harNameValue{Name: name, Value: value})
+		}
+	}
+	for _, cookie := range req.Cookies() {
+		value := cookie.Value
+		if cookie.Name == "access_token" {
+			value = redacted
+		}
+		entry.Request.Cookies = append(entry.Request.Cookies, harNameValue{Name: cookie.Name, Value: value})
+	}
+	if len(reqBody) > 0 {
+		text, _ := truncateBody(reqBody, traceBodyLimit)
+		entry.Request.PostData = &harPostData{MimeType: req.Header.Get("Content-Type"), Text: text}
+	}
+
+	if failure != nil {
+		entry.Error = failure.Error()
+	} else {
+		text, _ := truncateBody(resBody, traceBodyLimit)
+		entry.Response.Status = res.StatusCode
+		entry.Response.StatusText = http.StatusText(res.StatusCode)
+		entry.Response.HTTPVersion = res.Proto
+		entry.Response.Headers = harHeaders(resHeaders)
+		entry.Response.Content = harContent{Size: len(resBody), MimeType: res.Header.Get("Content-Type"), Text: text}
+		entry.Response.BodySize = len(resBody)
+		for _, cookie := range res.Cookies() {
+			value := cookie.Value
+			if cookie.Name == "access_token" {
+				value = redacted
+			}
+			entry.Response.Cookies = append(entry.Response.Cookies, harNameValue{Name: cookie.Name, Value: value})
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries = append(t.entries, entry)
+	if err := t.write(); err != nil {
+		fmt.Fprintf(t.warnings, "Failed to write the trace file: %v\n", err)
+	}
+}
+
+func (t *harTrace) write() error {
+	entries := t.entries
+	if entries == nil {
+		entries = []harEntry{}
+	}
+	data, err := json.MarshalIndent(harFile{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "sia", Version: version},
+		Entries: entries,
+	}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(t.path, data, 0600)
+}
+
+func harHeaders(headers http.Header) []harNameValue {
+	list := []harNameValue{}
+	for name, values := range headers {
+		for _, value := range values {
+			list = append(list, harNameValue{Name: name, Value: value})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
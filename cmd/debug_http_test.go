@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// TestRedactHeaders checks the API key and the login cookie are hidden and
+// the other headers are left alone
+func TestRedactHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers http.Header
+		want    http.Header
+	}{
+		{
+			name:    "API key",
+			headers: http.Header{"X-Requested-With": {"secret-key"}},
+			want:    http.Header{"X-Requested-With": {redacted}},
+		},
+		{
+			name:    "authorization",
+			headers: http.Header{"Authorization": {"Bearer secret-token"}},
+			want:    http.Header{"Authorization": {redacted}},
+		},
+		{
+			name:    "login cookie among others",
+			headers: http.Header{"Cookie": {"theme=dark; access_token=secret-token; lang=en"}},
+			want:    http.Header{"Cookie": {"theme=dark; access_token=" + redacted + "; lang=en"}},
+		},
+		{
+			name:    "set login cookie keeps its attributes",
+			headers: http.Header{"Set-Cookie": {"access_token=secret-token; Path=/; HttpOnly"}},
+			want:    http.Header{"Set-Cookie": {"access_token=" + redacted + "; Path=/; HttpOnly"}},
+		},
+		{
+			name:    "other cookies",
+			headers: http.Header{"Set-Cookie": {"theme=dark; Path=/"}, "Cookie": {"theme=dark"}},
+			want:    http.Header{"Set-Cookie": {"theme=dark; Path=/"}, "Cookie": {"theme=dark"}},
+		},
+		{
+			name:    "other headers",
+			headers: http.Header{"Content-Type": {"application/json"}},
+			want:    http.Header{"Content-Type": {"application/json"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := tt.headers.Clone()
+			got := redactHeaders(tt.headers)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("redactHeaders = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(tt.headers, original) {
+				t.Errorf("redactHeaders changed the headers sent to %v", tt.headers)
+			}
+		})
+	}
+}
+
+// TestRedactBody checks passwords and tokens are hidden in JSON and form
+// bodies, at any depth, and other bodies are left alone
+func TestRedactBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+	}{
+		{"login", "application/json", `{"password":"secret"}`, `{"password":"` + redacted + `"}`},
+		{"changepwd", "application/json", `{"old_password":"old","new_password":"new"}`, `{"new_password":"` + redacted + `","old_password":"` + redacted + `"}`},
+		{"nested", "application/json", `{"auth":[{"access_token":"t","api_key":"k"}]}`, `{"auth":[{"access_token":"` + redacted + `","api_key":"` + redacted + `"}]}`},
+		{"case of the field", "application/json", `{"Password":"secret"}`, `{"Password":"` + redacted + `"}`},
+		{"JSON without a content type", "", `{"password":"secret"}`, `{"password":"` + redacted + `"}`},
+		{"no secrets", "application/json", `{"name": "kb"}`, `{"name": "kb"}`},
+		{"form", "application/x-www-form-urlencoded", "password=secret&user=admin", "password=%5BREDACTED%5D&user=admin"},
+		{"text", "text/plain", "password=secret", "password=secret"},
+		{"invalid JSON", "application/json", `{"password":`, `{"password":`},
+		{"empty", "application/json", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(redactBody(tt.contentType, []byte(tt.body)))
+			if got != tt.want {
+				t.Errorf("redactBody(%q, %q) = %q, want %q", tt.contentType, tt.body, got, tt.want)
+			}
+		})
+	}
+}
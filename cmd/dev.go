@@ -0,0 +1,26 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// newDevCmd builds the dev parent command
+func newDevCmd(c *cli) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dev",
+		Short: "Tools for developing and demoing sia",
+		Long: `
+Tools for developing and demoing sia without a SIA server, such as fake-server.`,
+
+		// dev tools do not talk to a SIA server
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+
+	cmd.AddCommand(
+		newDevFakeServerCmd(c),
+	)
+	return cmd
+}
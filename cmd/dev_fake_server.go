@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+
+	"sia-cli/internal/fakeserver"
+)
+
+func newDevFakeServerCmd(c *cli) *cobra.Command {
+	var fakeServerListen string
+	var fakeServerAPIKey string
+	var fakeServerPassword string
+	var fakeServerScript string
+	var fakeServerNoDemo bool
+
+	cmd := &cobra.Command{
+		Use:   "fake-server",
+		Short: "Run an in-memory SIA server for demos and development",
+		Long: `
+Run an in-memory SIA server for demos and development. Nothing is saved, the agents are gone when it stops.
+
+1. It serves login, the admin password, agent create, list, view, pull, push and delete, and chat.
+2. Chat echoes the prompt, or answers with --script, a YAML file mapping prompts to answers:
+     "What can you do?": I answer questions about the demo documents.
+3. Point sia at it from another terminal with the SIA_SERVER_URL and SIA_API_KEY it prints.`,
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// Step 1: Load the scripted answers
+			script := map[string]string{}
+			if fakeServerScript != "" {
+				data, err := os.ReadFile(c.resolvePath(fakeServerScript))
+				if err != nil {
+					c.handleErr(err, "Failed to read the script")
+				}
+				if err := yaml.Unmarshal(data, &script); err != nil {
+					c.handleErr(err, "The script must map prompts to answers")
+				}
+			}
+
+			// Step 2: Create the server with a demo agent
+			server := fakeserver.New(fakeserver.Options{
+				APIKey:        fakeServerAPIKey,
+				AdminPassword: fakeServerPassword,
+				Script:        script,
+			})
+			if !fakeServerNoDemo {
+				server.AddAgent(fakeserver.Agent{
+					Name:             "demo",
+					Instructions:     "You are a demo agent of the SIA fake server.",
+					WelcomeMessage:   "Hello! I am the **demo** agent of the fake server.",
+					SuggestedPrompts: []string{"What can you do?", "Tell me a joke"},
+				})
+			}
+
+			// Step 3: Listen and print how to use it
+			listener, err := net.Listen("tcp", fakeServerListen)
+			if err != nil {
+				c.handleErr(err, "Failed to start the server")
+			}
+			serverURL := fmt.Sprintf("http://%s", listener.Addr())
+			if host, port, err := net.SplitHostPort(listener.Addr().String()); err == nil && net.ParseIP(host).IsUnspecified() {
+				serverURL = fmt.Sprintf("http://localhost:%s", port)
+			}
+			fmt.Fprintf(c.stdout, "Fake SIA server listening on %s (Ctrl-C to stop)\n", serverURL)
+			fmt.Fprintln(c.stdout)
+			fmt.Fprintf(c.stdout, "  export SIA_SERVER_URL=%s\n", serverURL)
+			fmt.Fprintf(c.stdout, "  export SIA_API_KEY=%s\n", fakeServerAPIKey)
+			if fakeServerPassword != "" {
+				fmt.Fprintf(c.stdout, "  sia login   # the admin password is %s\n", fakeServerPassword)
+			} else {
+				fmt.Fprintln(c.stdout, "  sia setpwd  # set the admin password first")
+			}
+			fmt.Fprintln(c.stdout)
+
+			httpServer := &http.Server{Handler: server}
+			go func() {
+				<-cmd.Context().Done()
+				ctx, cancel := context.WithTimeout(context.Background(), shutdownGracePeriod)
+				defer cancel()
+				httpServer.Shutdown(ctx)
+			}()
+			if err := httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+				c.handleErr(err, "Failed to run the server")
+			}
+			fmt.Fprintln(c.stdout, "Server stopped.")
+		},
+	}
+
+	cmd.Flags().StringVarP(&fakeServerListen, "listen", "l", "127.0.0.1:8080", "Address to listen on")
+	cmd.Flags().StringVar(&fakeServerAPIKey, "api-key", "fake-api-key", "API key clients must send")
+	cmd.Flags().StringVar(&fakeServerPassword, "admin-password", "fake-password", "Admin password, empty to set it with 'sia setpwd'")
+	cmd.Flags().StringVar(&fakeServerScript, "script", "", "YAML file mapping prompts to chat answers")
+	cmd.Flags().BoolVar(&fakeServerNoDemo, "no-demo", false, "Start without the demo agent")
+
+	return cmd
+}
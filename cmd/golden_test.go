@@ -0,0 +1,382 @@
+package cmd
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"sia-cli/internal/fakeserver"
+	"sia-cli/internal/golden"
+)
+
+// After changing what a command prints, rewrite the golden files and review
+// the diff before committing it:
+//
+//	go test ./cmd -run TestGolden -update
+//	git diff testdata/golden
+var update = flag.Bool("update", false, "rewrite the golden files with the current output")
+
+// Settings of the fake server the golden runs talk to
+const (
+	goldenAPIKey   = "golden-api-key"
+	goldenPassword = "golden-password"
+)
+
+// goldenClock is the time of the fake server, so that dates in the output
+// do not change between runs
+var goldenClock = time.Date(2025, time.March, 4, 5, 6, 7, 0, time.UTC)
+
+// goldenStep is one run of the CLI, compared with testdata/golden/<name>.golden
+type goldenStep struct {
+	name  string
+	args  []string
+	stdin string
+	// env is added to the environment of the runs, an empty value removes a variable
+	env map[string]string
+	// before changes the server before the run, e.g. to end the sessions
+	before func(server *fakeserver.Server)
+	// files written by the run in the working directory to add to the golden file
+	files []string
+	// noSecrets fails the step when the API key, the admin password or the
+	// saved access token appear in the output or the files
+	noSecrets bool
+}
+
+// goldenFiles are written to the working directory before the first step
+var goldenFiles = map[string]string{
+	"agent.yaml": `name: kb
+instructions: Answer questions about the notes.
+welcome_message: Ask me about the notes.
+suggested_prompts:
+  - What is in the notes?
+new_files:
+  - filepath: notes.txt
+    meta:
+      split_by: word
+      split_length: 100
+`,
+	"update.yaml": `name: kb
+instructions: Answer questions about the notes in one sentence.
+welcome_message: Ask me anything about the notes.
+suggested_prompts:
+  - What is in the notes?
+`,
+	"delete-notes.yaml": `name: kb
+instructions: Answer questions about the notes in one sentence.
+deleted_files:
+  - notes.txt
+`,
+	"notes.txt":    "The notes of the golden runs.\n",
+	"bad.yaml":     "name: [kb\ninstructions: unclosed\n",
+	"invalid.yaml": "name: not a valid name\ninstructions: The name has blanks.\n",
+}
+
+// goldenSteps run in order against one fake server and share the home and
+// working directories, so later steps see the login and agents of earlier ones
+var goldenSteps = []goldenStep{
+	{name: "login-wrong-password", args: []string{"login", "--password-stdin"}, stdin: "wrong-password\n"},
+	{name: "login", args: []string{"login", "--password-stdin"}, stdin: goldenPassword + "\n"},
+	{name: "agent-ls", args: []string{"agent", "ls"}},
+	{name: "agent-create", args: []string{"agent", "create"}, files: []string{"agent-name.yaml"}},
+	{name: "agent-create-named", args: []string{"agent", "create", "notes-bot"}, files: []string{"notes-bot.yaml"}},
+	{name: "agent-create-exists", args: []string{"agent", "create", "notes-bot"}},
+	{name: "agent-create-bad-name", args: []string{"agent", "create", "notes bot"}},
+	{name: "agent-push-bad-yaml", args: []string{"agent", "push", "bad.yaml", "-a", "create"}},
+	{name: "agent-push-missing-file", args: []string{"agent", "push", "missing.yaml", "-a", "create"}},
+	{name: "agent-push-invalid-name", args: []string{"agent", "push", "invalid.yaml", "-a", "create"}},
+	{name: "agent-push-create", args: []string{"agent", "push", "agent.yaml", "-a", "create"}},
+	{name: "agent-push-name-mismatch", args: []string{"agent", "push", "-a", "update", "-n", "other", "-f", "update.yaml"}},
+	{name: "agent-push-update", args: []string{"agent", "push", "update.yaml", "-a", "update", "--rm-file"}},
+	{name: "agent-view", args: []string{"agent", "view", "kb"}},
+	{name: "agent-view-many", args: []string{"agent", "view", "demo", "kb"}},
+	{name: "agent-view-name-flag", args: []string{"agent", "view", "-n", "kb"}},
+	{name: "agent-view-no-name", args: []string{"agent", "view"}},
+	{name: "agent-view-missing", args: []string{"agent", "view", "missing"}},
+	{name: "agent-pull", args: []string{"agent", "pull", "kb"}, files: []string{"kb.yaml"}},
+	{name: "agent-pull-bad-name", args: []string{"agent", "pull", "../kb"}, files: []string{"../kb.yaml"}},
+	{name: "agent-ls-after-push", args: []string{"agent", "ls"}},
+	{name: "complete-agent-names", args: []string{"__complete", "agent", "view", ""}},
+	{name: "complete-more-agent-names", args: []string{"__complete", "agent", "view", "kb", ""}},
+	{name: "complete-push-action", args: []string{"__complete", "agent", "push", "-a", ""}},
+	{
+		name:      "login-trace",
+		args:      []string{"-vvv", "--trace-file", "login.har", "login", "--password-stdin"},
+		stdin:     goldenPassword + "\n",
+		files:     []string{"login.har"},
+		noSecrets: true,
+	},
+	{name: "agent-ls-record", args: []string{"--record", "ls.cassette.json", "agent", "ls"}, files: []string{"ls.cassette.json"}, noSecrets: true},
+	{
+		name: "agent-ls-replay",
+		args: []string{"--replay", "ls.cassette.json", "agent", "ls"},
+		env:  map[string]string{"SIA_SERVER_URL": "http://replay.invalid"},
+	},
+	{
+		name: "agent-view-replay-missing",
+		args: []string{"--replay", "ls.cassette.json", "agent", "view", "kb"},
+		env:  map[string]string{"SIA_SERVER_URL": "http://replay.invalid"},
+	},
+	{name: "agent-chat", args: []string{"agent", "chat", "kb"}, stdin: "What is in the notes?\nhello\nq\n"},
+	{
+		name:   "session-expired",
+		args:   []string{"agent", "ls"},
+		before: func(server *fakeserver.Server) { server.ExpireSessions() },
+	},
+	{
+		name:   "session-expired-relogin",
+		args:   []string{"agent", "ls"},
+		env:    map[string]string{"SIA_ADMIN_PASSWORD": goldenPassword},
+		before: func(server *fakeserver.Server) { server.ExpireSessions() },
+	},
+	{name: "wrong-api-key", args: []string{"agent", "ls"}, env: map[string]string{"SIA_API_KEY": "wrong-key"}},
+	{name: "agent-push-deleted-files-unconfirmed", args: []string{"agent", "push", "delete-notes.yaml", "-a", "update"}},
+	{name: "agent-push-deleted-files", args: []string{"agent", "push", "delete-notes.yaml", "-a", "update", "--yes"}},
+	{name: "agent-delete-unconfirmed", args: []string{"agent", "delete", "kb"}},
+	{name: "agent-delete", args: []string{"agent", "delete", "kb", "--yes"}},
+	{name: "agent-delete-missing", args: []string{"agent", "delete", "kb", "--yes"}},
+	{name: "logout", args: []string{"logout"}},
+	{name: "agent-ls-logged-out", args: []string{"agent", "ls"}},
+	{name: "missing-api-key", args: []string{"agent", "ls"}, env: map[string]string{"SIA_API_KEY": ""}},
+}
+
+// TestGolden runs login, logout, the agent commands and their error paths
+// in-process against the fake server, and compares stdout, stderr, the exit
+// code and the files they wrote with the files in testdata/golden. The server
+// URL and the scratch directory are replaced by $SIA_SERVER_URL and $TMP in
+// the output, and the escape character by \033
+func TestGolden(t *testing.T) {
+	server := fakeserver.New(fakeserver.Options{
+		APIKey:        goldenAPIKey,
+		AdminPassword: goldenPassword,
+		Script:        map[string]string{"What is in the notes?": "The notes of the **golden** runs."},
+		Now:           func() time.Time { return goldenClock },
+	})
+	server.AddAgent(fakeserver.Agent{
+		Name:             "demo",
+		Instructions:     "You are a demo agent.",
+		WelcomeMessage:   "Hello from the demo agent.",
+		SuggestedPrompts: []string{"What can you do?"},
+	})
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	scratchDir := t.TempDir()
+	homeDir := filepath.Join(scratchDir, "home")
+	workDir := filepath.Join(scratchDir, "work")
+	for _, d := range []string{homeDir, workDir} {
+		if err := os.Mkdir(d, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, content := range goldenFiles {
+		if err := os.WriteFile(filepath.Join(workDir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// dates are printed in the local time zone
+	savedLocal := time.Local
+	time.Local = time.UTC
+	defer func() { time.Local = savedLocal }()
+
+	env := map[string]string{
+		"HOME":           homeDir,
+		"USERPROFILE":    homeDir,
+		"SIA_SERVER_URL": ts.URL,
+		"SIA_API_KEY":    goldenAPIKey,
+	}
+	// escape sequences are written out so the golden files stay readable
+	normalize := strings.NewReplacer(ts.URL, "$SIA_SERVER_URL", scratchDir, "$TMP", "\033", `\033`)
+	for _, step := range goldenSteps {
+		t.Run(step.name, func(t *testing.T) {
+			if step.before != nil {
+				step.before(server)
+			}
+			output, err := runGoldenStep(step, env, workDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if step.noSecrets {
+				secrets := []string{goldenAPIKey, goldenPassword}
+				if token, err := os.ReadFile(filepath.Join(homeDir, TokenDir, TokenFilename)); err == nil {
+					secrets = append(secrets, string(token))
+				}
+				// the password may be given on stdin, but must not be printed
+				printed := strings.Replace(output, "--- stdin\n"+step.stdin, "", 1)
+				for _, secret := range secrets {
+					if strings.Contains(printed, secret) {
+						t.Errorf("the output has the secret %q", secret)
+					}
+				}
+			}
+			output = normalizeTimings(output)
+			path := filepath.Join("..", "testdata", "golden", step.name+".golden")
+			if err := golden.Compare(path, []byte(normalize.Replace(output)), *update); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// goldenTimings match the times and durations that change between runs:
+// the elapsed time of -v, the Date header, the timings of HAR files and the
+// time a cassette was recorded
+var goldenTimings = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`\(\d+(\.\d+)?(ns|µs|ms|s)\)`), "(TIME)"},
+	{regexp.MustCompile(`(?m)^([<>] Date:) .*$`), "$1 DATE"},
+	{regexp.MustCompile(`("(?:startedDateTime|recorded_at)": )"[^"]*"`), `$1"DATE"`},
+	{regexp.MustCompile(`("(?:time|send|wait|receive)": )[\d.]+`), "${1}0"},
+	{regexp.MustCompile(`"\w{3}, \d{2} \w{3} \d{4} \d{2}:\d{2}:\d{2} GMT"`), `"DATE"`},
+}
+
+// normalizeTimings replaces the times and durations in the output of a run
+func normalizeTimings(output string) string {
+	for _, timing := range goldenTimings {
+		output = timing.pattern.ReplaceAllString(output, timing.replacement)
+	}
+	return output
+}
+
+// runGoldenStep runs the step and formats what it did as a golden file
+func runGoldenStep(step goldenStep, suiteEnv map[string]string, workDir string) (string, error) {
+	env := map[string]string{}
+	for key, value := range suiteEnv {
+		env[key] = value
+	}
+	for key, value := range step.env {
+		if value == "" {
+			delete(env, key)
+			continue
+		}
+		env[key] = value
+	}
+
+	result := runInProcess(runOptions{args: step.args, env: env, stdin: step.stdin, dir: workDir})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "$ sia %s\n", strings.Join(step.args, " "))
+	if step.stdin != "" {
+		fmt.Fprintf(&b, "--- stdin\n%s", step.stdin)
+	}
+	b.WriteString(result.String())
+	for _, name := range step.files {
+		content, err := os.ReadFile(filepath.Join(workDir, name))
+		if err != nil {
+			fmt.Fprintf(&b, "--- file %s: %v\n", name, err)
+			continue
+		}
+		fmt.Fprintf(&b, "--- file %s\n%s", name, content)
+		if len(content) > 0 && content[len(content)-1] != '\n' {
+			b.WriteString("\n")
+		}
+	}
+	return b.String(), nil
+}
+
+// runOptions describe a run of the CLI in this process
+type runOptions struct {
+	args []string
+	// env is the whole environment of the run, the environment of the
+	// process is not used. HOME should point to a scratch directory
+	env   map[string]string
+	stdin string
+	// dir is the working directory of the run, the current one when empty
+	dir string
+}
+
+// runResult is what a run printed and how it exited
+type runResult struct {
+	stdout   string
+	stderr   string
+	exitCode int
+}
+
+// exitSignal is raised by exit during runInProcess to unwind the command
+type exitSignal struct {
+	code int
+}
+
+// syncBuffer collects the output of a run, which requests logged by workers
+// write to concurrently
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// runInProcess runs the CLI as 'sia <args>' would, without starting a
+// process. The run gets its own streams, environment and working directory,
+// and exit unwinds the command so that its exit code is recorded
+func runInProcess(opts runOptions) runResult {
+	// Step 1: Set up a run that only sees opts
+	var stdout, stderr syncBuffer
+	env := opts.env
+	c := &cli{
+		stdin:  strings.NewReader(opts.stdin),
+		stdout: &stdout,
+		stderr: &stderr,
+		lookupEnv: func(key string) (string, bool) {
+			value, ok := env[key]
+			return value, ok
+		},
+		dir:  opts.dir,
+		exit: func(code int) { panic(exitSignal{code: code}) },
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Step 2: Run the command, turning exit into the exit code
+	exitCode := func() (code int) {
+		defer func() {
+			if r := recover(); r != nil {
+				signal, ok := r.(exitSignal)
+				if !ok {
+					panic(r)
+				}
+				code = signal.code
+			}
+		}()
+		if err := c.execute(ctx, opts.args); err != nil {
+			return ExitError
+		}
+		return 0
+	}()
+	return runResult{stdout: stdout.String(), stderr: stderr.String(), exitCode: exitCode}
+}
+
+// String formats the result as it is kept in golden files
+func (r runResult) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- stdout\n%s", r.stdout)
+	if r.stdout != "" && !strings.HasSuffix(r.stdout, "\n") {
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "--- stderr\n%s", r.stderr)
+	if r.stderr != "" && !strings.HasSuffix(r.stderr, "\n") {
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "--- exit code %d\n", r.exitCode)
+	return b.String()
+}
@@ -2,184 +2,414 @@ package cmd
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
-	"regexp"
+	"runtime"
 	"strings"
 
 	"golang.org/x/term"
 )
 
 const (
-	TokenDir      = ".sia"
-	TokenFilename = ".access_token"
+	TokenDir            = ".sia"
+	TokenFilename       = ".access_token"
+	TokenServerFilename = ".access_token_server"
 )
 
+// Exit codes
+const (
+	ExitError     = 1
+	ExitAuth      = 3   // not logged in or the session has expired
+	ExitCancelled = 130 // as for a process killed by SIGINT
+)
+
+// userHomeDir returns the home directory from the environment of the run
+func (c *cli) userHomeDir() (string, error) {
+	name := "HOME"
+	if runtime.GOOS == "windows" {
+		name = "USERPROFILE"
+	}
+	if homeDir := c.getenv(name); homeDir != "" {
+		return homeDir, nil
+	}
+	return os.UserHomeDir()
+}
+
 // handleErr to handle errors for non-command functions
-func handleErr(err error, msg string) {
-	fmt.Println(err)
+func (c *cli) handleErr(err error, msg string) {
+	// cancellation and timeouts get their own messages
+	if errors.Is(err, context.Canceled) || c.ctx.Err() != nil {
+		c.exitCancelled()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		fmt.Fprintln(c.stdout, err)
+		fmt.Fprintln(c.stdout, "Error: the request timed out. Use --timeout to allow more time")
+		c.exit(ExitError)
+	}
+	if err != nil {
+		fmt.Fprintln(c.stdout, err)
+	}
 	if msg != "" {
-		fmt.Printf("Error: %s\n", msg)
+		fmt.Fprintf(c.stdout, "Error: %s\n", msg)
 	} else if err != nil {
-		fmt.Printf("Error: %v\n", err)
+		fmt.Fprintf(c.stdout, "Error: %v\n", err)
 	} else {
-		fmt.Printf("Unknown error\n")
+		fmt.Fprintf(c.stdout, "Unknown error\n")
 	}
-	os.Exit(1)
+	c.exit(ExitError)
+}
+
+// handleAuthErr exits with ExitAuth when a command needs a login it does not have
+func (c *cli) handleAuthErr(msg string) {
+	fmt.Fprintf(c.stdout, "Error: %s\n", msg)
+	c.exit(ExitAuth)
+}
+
+// exitCancelled exits after the user cancelled the command
+func (c *cli) exitCancelled() {
+	fmt.Fprintln(c.stderr, "\nCancelled.")
+	c.exit(ExitCancelled)
 }
 
 // Generic must function that takes a value, an error, and a custom message
-func must[T any](value T, err error, msg string) T {
+func must[T any](c *cli, value T, err error, msg string) T {
 	if err != nil {
-		handleErr(err, msg)
+		c.handleErr(err, msg)
 	}
 	return value
 }
 
 // check EnvVars
-func checkEnvVars() {
-	siaServerURL := os.Getenv("SIA_SERVER_URL")
-	siaAPIKey := os.Getenv("SIA_API_KEY")
-	if siaServerURL == "" || siaAPIKey == "" {
-		handleErr(fmt.Errorf("SIA_SERVER_URL and SIA_API_KEY must be set before using this CLI"), "")
+func (c *cli) checkEnvVars() {
+	siaServerURL := c.getenv("SIA_SERVER_URL")
+	if siaServerURL == "" || c.resolveAPIKey() == "" {
+		c.handleErr(fmt.Errorf("SIA_SERVER_URL and SIA_API_KEY must be set before using this CLI, or the API key given by the credential_helper of the profile"), "")
 	}
 }
 
-// to check if url is localhost
-func confirmIfLocalHost() {
-	// Define a regex pattern to match "http://localhost" on any port
-	urlPattern := `^(http|https)://localhost(:\d+)?$`
-
-	var err error
+// confirmIfLocalHost exits unless SIA_SERVER_URL is this machine, so that
+// commands meant for the server console are not run against a remote server.
+// allowRemote turns the error into a warning
+func (c *cli) confirmIfLocalHost(allowRemote bool) {
 	// get the url
-	serverURL := os.Getenv("SIA_SERVER_URL")
+	serverURL := c.getenv("SIA_SERVER_URL")
 	if serverURL == "" {
-		err = errors.New("SIA_SERVER_URL has not been set")
-		handleErr(err, "")
+		c.handleErr(errors.New("SIA_SERVER_URL has not been set"), "")
 	}
 
-	// check if matches
-	matched, err := regexp.MatchString(urlPattern, serverURL)
-	if err != nil {
-		err = errors.New("failed to validate server URL")
+	err := checkLocalServerURL(serverURL, net.LookupIP)
+	if err == nil {
+		return
 	}
-	// return results
-	if !matched {
-		err = errors.New("Access is permitted only from server console")
+	// --allow-remote cannot help when the client cannot connect at all
+	if errors.Is(err, errUnixSocketURL) {
+		c.handleErr(nil, err.Error())
 	}
-	return
+	if allowRemote {
+		fmt.Fprintf(c.stderr, "Warning: %v. Continuing because of --allow-remote.\n", err)
+		return
+	}
+	c.handleErr(nil, fmt.Sprintf("Access is permitted only from the server console: %v. Use --allow-remote to override", err))
 }
 
-// save token
-func saveAccessToken(accessToken string) {
-	// Get the user's home directory
-	homeDir, err := os.UserHomeDir()
+// errUnixSocketURL is returned for server URLs that --allow-remote cannot help with
+var errUnixSocketURL = errors.New("Unix socket URLs are not supported, use the http://127.0.0.1 address the server listens on instead")
+
+// checkLocalServerURL returns an error unless the URL is an http or https URL
+// whose host is a loopback address or a name that only resolves to loopback
+// addresses. Unix socket URLs are not supported, as the HTTP client cannot
+// dial them, and get an error that says so. lookupIP resolves host names,
+// e.g. net.LookupIP
+func checkLocalServerURL(serverURL string, lookupIP func(host string) ([]net.IP, error)) error {
+	// the socket path of http+unix URLs is escaped in the host, which
+	// url.Parse rejects, so look at the scheme first
+	scheme, _, _ := strings.Cut(strings.TrimSpace(serverURL), ":")
+	switch strings.ToLower(scheme) {
+	case "unix", "http+unix", "https+unix":
+		return fmt.Errorf("SIA_SERVER_URL %q: %w", serverURL, errUnixSocketURL)
+	}
+
+	parsed, err := url.Parse(strings.TrimSpace(serverURL))
 	if err != nil {
-		handleErr(err, "failed to retrieve user home directory")
+		return fmt.Errorf("SIA_SERVER_URL %q is not a valid URL", serverURL)
 	}
 
-	// Define the path to save the access token
-	tokenFilePath := filepath.Join(homeDir, TokenDir, TokenFilename)
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "https":
+	default:
+		return fmt.Errorf("SIA_SERVER_URL %q is not an http or https URL", serverURL)
+	}
 
-	// Ensure the `.sia` directory exists
-	siaDir := filepath.Join(homeDir, ".sia")
-	if _, err := os.Stat(siaDir); os.IsNotExist(err) {
-		err := os.Mkdir(siaDir, 0700)
-		if err != nil {
-			message := fmt.Sprintf("failed to created directory %s:", siaDir)
-			handleErr(err, message)
+	host := parsed.Hostname()
+	if host == "" {
+		return fmt.Errorf("SIA_SERVER_URL %q has no host", serverURL)
+	}
+
+	// IP addresses in any form, e.g. 127.0.0.1, 127.1.2.3, ::1, [::1] or ::ffff:127.0.0.1
+	if ip := net.ParseIP(strings.Split(host, "%")[0]); ip != nil {
+		if ip.IsLoopback() {
+			return nil
 		}
+		return fmt.Errorf("%s is not a loopback address", host)
+	}
+
+	// localhost and its subdomains are always loopback (RFC 6761)
+	name := strings.TrimSuffix(strings.ToLower(host), ".")
+	if name == "localhost" || strings.HasSuffix(name, ".localhost") {
+		return nil
 	}
 
-	// Save the access token to the file
-	err = os.WriteFile(tokenFilePath, []byte(accessToken), 0600)
+	// any other name must only resolve to loopback addresses
+	ips, err := lookupIP(name)
 	if err != nil {
-		handleErr(err, "failed to save access token")
+		return fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+	if len(ips) == 0 {
+		return fmt.Errorf("%s does not resolve to any address", host)
+	}
+	for _, ip := range ips {
+		if !ip.IsLoopback() {
+			return fmt.Errorf("%s resolves to %s, which is not a loopback address", host, ip)
+		}
+	}
+	return nil
+}
+
+// save token
+func (c *cli) saveAccessToken(accessToken string) {
+	// Save the access token in the credential store of the profile
+	store := c.credentialStore()
+	if err := store.Set(credentialAccessToken, accessToken); err != nil {
+		c.handleErr(err, "failed to save access token")
+	}
+
+	// Remember which server the token is for
+	if err := store.Set(credentialTokenServer, c.getenv("SIA_SERVER_URL")); err != nil {
+		c.handleErr(err, "failed to save access token")
 	}
 }
 
 // delete token
-func deleteAccessToken() {
-	// Get the user's home directory
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		handleErr(err, "failed to retrieve user home directory")
+func (c *cli) deleteAccessToken() {
+	store := c.credentialStore()
+	if err := store.Delete(credentialAccessToken); err != nil {
+		c.handleErr(err, "failed to delete access token")
 	}
+	// tokens saved by older versions have no server
+	store.Delete(credentialTokenServer)
+}
 
-	// Define the path to save the access token
-	tokenFilePath := filepath.Join(homeDir, TokenDir, TokenFilename)
+// readAccessTokenServer returns the server the saved access token is for, or
+// "" when it is not known
+func (c *cli) readAccessTokenServer() string {
+	server, err := c.credentialStore().Get(credentialTokenServer)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(server)
+}
 
-	// Ensure the `.sia` directory exists
-	siaDir := filepath.Join(homeDir, ".sia")
-	if _, err := os.Stat(siaDir); os.IsNotExist(err) {
-		err := os.Mkdir(siaDir, 0700)
-		if err != nil {
-			message := fmt.Sprintf("failed to created directory %s:", siaDir)
-			handleErr(err, message)
+// readAccessToken returns the saved access token without exiting when there
+// is none. Without a saved token the credential helper is asked for one
+func (c *cli) readAccessToken() (string, error) {
+	store, err := c.activeCredentialStore()
+	if err != nil {
+		return "", err
+	}
+	accessToken, err := store.Get(credentialAccessToken)
+	if errors.Is(err, errCredentialNotFound) {
+		helperToken, helperErr := c.runCredentialHelper(CredentialKindToken)
+		if helperErr != nil {
+			return "", helperErr
+		}
+		if helperToken != "" {
+			return strings.TrimSpace(helperToken), nil
 		}
 	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(accessToken), nil
+}
+
+func (c *cli) checkAccessToken() []byte {
+	accessToken, err := c.readAccessToken()
+	if err != nil && !errors.Is(err, errCredentialNotFound) {
+		c.handleErr(err, "Failed to read the access token")
+	}
+	if accessToken == "" {
+		c.handleAuthErr("Login required. Use 'sia login'")
+	}
+	return []byte(accessToken)
+}
+
+// isInteractive reports whether stdin is a terminal that can be prompted on
+func (c *cli) isInteractive() bool {
+	_, ok := terminalFd(c.stdin)
+	return ok
+}
+
+// terminalFd returns the file descriptor of a stream that is a terminal
+func terminalFd(stream any) (int, bool) {
+	file, ok := stream.(*os.File)
+	if !ok || !term.IsTerminal(int(file.Fd())) {
+		return 0, false
+	}
+	return int(file.Fd()), true
+}
 
-	// delete the the file
-	err = os.Remove(tokenFilePath)
+// terminalWidth returns the width of stdout or a sensible default when it is not a terminal
+func (c *cli) terminalWidth() int {
+	fd, ok := terminalFd(c.stdout)
+	if !ok {
+		return 100
+	}
+	width, _, err := term.GetSize(fd)
+	if err != nil || width <= 0 {
+		return 100
+	}
+	return width
+}
+
+// readPasswordStdin reads a password piped to stdin, without the line break
+func (c *cli) readPasswordStdin() string {
+	password, err := io.ReadAll(c.stdin)
 	if err != nil {
-		handleErr(err, "failed to delete access token")
+		c.handleErr(err, "Failed to read the password from stdin")
+	}
+	if len(password) == 0 {
+		c.handleErr(nil, "No password given on stdin")
 	}
+	return strings.TrimRight(string(password), "\r\n")
 }
 
-func checkAccessToken() []byte {
-	homeDir, _ := os.UserHomeDir()
-	tokenFilePath := filepath.Join(homeDir, TokenDir, TokenFilename)
-	accessToken, err := os.ReadFile(tokenFilePath)
-	if err != nil || accessToken == nil {
-		handleErr(err, "Login required. Use 'sia login'")
+// readPasswordLinesStdin reads count passwords piped to stdin, one per line
+func (c *cli) readPasswordLinesStdin(count int) []string {
+	data, err := io.ReadAll(c.stdin)
+	if err != nil {
+		c.handleErr(err, "Failed to read the passwords from stdin")
 	}
-	return accessToken
+	lines := strings.Split(strings.TrimRight(string(data), "\r\n"), "\n")
+	if len(lines) != count {
+		c.handleErr(nil, fmt.Sprintf("Expected %d lines on stdin, got %d", count, len(lines)))
+	}
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, "\r")
+		if lines[i] == "" {
+			c.handleErr(nil, fmt.Sprintf("Line %d on stdin is empty", i+1))
+		}
+	}
+	return lines
+}
+
+// readPasswordFile reads a password from the first line of a file
+func (c *cli) readPasswordFile(path string) string {
+	filePath := c.resolvePath(path)
+	info, err := os.Stat(filePath)
+	if err != nil {
+		c.handleErr(err, "Failed to read the password file")
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		fmt.Fprintf(c.stderr, "Warning: %s can be read by other users. Use chmod 600 %s\n", path, path)
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		c.handleErr(err, "Failed to read the password file")
+	}
+	password, _, _ := strings.Cut(string(data), "\n")
+	password = strings.TrimRight(password, "\r")
+	if password == "" {
+		c.handleErr(nil, fmt.Sprintf("The password file %s is empty", path))
+	}
+	return password
 }
 
 // to read hidden Input
-func readHiddenTextInput(prompt string) string {
-	fmt.Print(prompt)
-	bytePassword, err := term.ReadPassword(int(os.Stdin.Fd()))
+func (c *cli) readHiddenTextInput(prompt string) string {
+	fd, ok := terminalFd(c.stdin)
+	if !ok {
+		c.handleErr(nil, "No terminal to read the input from. Run the command in a terminal")
+	}
+	fmt.Fprint(c.stdout, prompt)
+	bytePassword, err := term.ReadPassword(fd)
 	if err != nil {
-		handleErr(err, "text entry error")
+		c.handleErr(err, "text entry error")
 	}
-	fmt.Println() // Newline after input is required
+	fmt.Fprintln(c.stdout) // Newline after input is required
 	return strings.TrimSpace(string(bytePassword))
 }
 
+// lineReader returns the reader of the lines typed on stdin. It is shared so
+// that a line typed ahead, e.g. the next confirmation, is not lost in the
+// buffer of an earlier read
+func (c *cli) lineReader() *bufio.Reader {
+	if c.stdinLines == nil {
+		c.stdinLines = bufio.NewReader(c.stdin)
+	}
+	return c.stdinLines
+}
+
 // readVisiblePassword reads a password with visible input
-func readVisibleTextInput(prompt string) string {
-	fmt.Print(prompt)
-	reader := bufio.NewReader(os.Stdin)
-	line, err := reader.ReadString('\n')
+func (c *cli) readVisibleTextInput(prompt string) string {
+	fmt.Fprint(c.stdout, prompt)
+	line, err := c.lineReader().ReadString('\n')
 	if err != nil {
-		handleErr(err, "text entry error")
+		c.handleErr(err, "text entry error")
 	}
 	return strings.TrimSpace(line)
 }
 
+// confirmByTyping goes ahead with a destructive action once the user types
+// the expected name, or straight away with yes (--yes). Without a terminal
+// to ask on it exits unless yes is set
+func (c *cli) confirmByTyping(yes bool, action, expected string) {
+	if yes {
+		return
+	}
+	if !c.isInteractive() {
+		c.handleErr(nil, fmt.Sprintf("Refusing to %s without confirmation as there is no terminal to ask on. Use --yes to confirm", action))
+	}
+	typed := c.readVisibleTextInput(fmt.Sprintf("This will %s and cannot be undone. Type %s to confirm: ", action, expected))
+	if typed != expected {
+		c.handleErr(nil, fmt.Sprintf("%q does not match %s, nothing was changed", typed, expected))
+	}
+}
+
 // resolve path
-func resolvePath(path string) string {
+func (c *cli) resolvePath(path string) string {
 	// Check if the path starts with "~", indicating the home directory
 	if strings.HasPrefix(path, "~") {
-		homeDir, err := os.UserHomeDir()
+		homeDir, err := c.userHomeDir()
 		if err != nil {
-			handleErr(err, "failed to get home directory")
+			c.handleErr(err, "failed to get home directory")
 		}
 		path = filepath.Join(homeDir, path[1:])
 	}
 
 	// Convert to absolute path for relative paths
-	absPath, err := filepath.Abs(path)
+	absPath, err := filepath.Abs(c.workPath(path))
 	if err != nil {
-		handleErr(err, "failed to get absolute path")
+		c.handleErr(err, "failed to get absolute path")
 	}
 
 	return absPath
 }
 
+// workPath returns the path of a file given on the command line, relative
+// paths being relative to the working directory of the run
+func (c *cli) workPath(path string) string {
+	if c.dir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(c.dir, path)
+}
+
 // delete file
 func deleteFile(filePath string) error {
 	err := os.Remove(filePath)
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestCheckLocalServerURL(t *testing.T) {
+	// names resolve without DNS, like /etc/hosts entries
+	hosts := map[string][]net.IP{
+		"sia.internal":  {net.ParseIP("10.1.2.3")},
+		"mixed.example": {net.ParseIP("127.0.0.1"), net.ParseIP("192.0.2.1")},
+		"loopback.test": {net.ParseIP("127.0.0.1"), net.ParseIP("::1")},
+	}
+	lookupIP := func(host string) ([]net.IP, error) {
+		ips, ok := hosts[host]
+		if !ok {
+			return nil, errors.New("no such host")
+		}
+		return ips, nil
+	}
+
+	tests := []struct {
+		url   string
+		local bool
+	}{
+		{"http://localhost:8080", true},
+		{"https://LOCALHOST.", true},
+		{"http://api.localhost:8080", true},
+		{"http://127.0.0.1:8080", true},
+		{"http://127.1.2.3", true},
+		{"http://[::1]:8080", true},
+		{"http://[::ffff:127.0.0.1]:8080", true},
+		{"http://loopback.test", true},
+		{"http://10.0.0.1:8080", false},
+		{"http://[::ffff:10.0.0.1]", false},
+		{"http://sia.internal", false},
+		{"http://mixed.example", false},
+		{"http://unknown.example", false},
+		{"http://127.0.0.1.nip.io", false},
+		{"unix:///run/sia.sock", false},
+		{"http+unix://%2Frun%2Fsia.sock", false},
+		{"ftp://localhost", false},
+		{"localhost:8080", false},
+		{"http://", false},
+	}
+	for _, tt := range tests {
+		err := checkLocalServerURL(tt.url, lookupIP)
+		if tt.local && err != nil {
+			t.Errorf("checkLocalServerURL(%q) = %v, want nil", tt.url, err)
+		}
+		if !tt.local && err == nil {
+			t.Errorf("checkLocalServerURL(%q) = nil, want an error", tt.url)
+		}
+	}
+}
+
+// TestCheckLocalServerURLUnixSocket checks Unix socket URLs get an error
+// that says they are not supported
+func TestCheckLocalServerURLUnixSocket(t *testing.T) {
+	for _, serverURL := range []string{"unix:///run/sia.sock", "http+unix://%2Frun%2Fsia.sock", "HTTPS+UNIX://%2Frun%2Fsia.sock/api"} {
+		err := checkLocalServerURL(serverURL, nil)
+		if !errors.Is(err, errUnixSocketURL) {
+			t.Errorf("checkLocalServerURL(%q) = %v, want %v", serverURL, err, errUnixSocketURL)
+		}
+	}
+}
+
+// TestConfirmIfLocalHostUnixSocket checks --allow-remote does not let a Unix
+// socket URL through, as the client cannot connect to it
+func TestConfirmIfLocalHostUnixSocket(t *testing.T) {
+	var stdout strings.Builder
+	c := newTestCLI(t, map[string]string{"SIA_SERVER_URL": "unix:///run/sia.sock"})
+	c.stdout = &stdout
+	c.exit = func(code int) { panic(exitSignal{code: code}) }
+
+	func() {
+		defer func() {
+			if _, ok := recover().(exitSignal); !ok {
+				t.Error("confirmIfLocalHost(true) did not exit for a Unix socket URL")
+			}
+		}()
+		c.confirmIfLocalHost(true)
+	}()
+	if !strings.Contains(stdout.String(), "Unix socket URLs are not supported") {
+		t.Errorf("stdout = %q, want the Unix socket error", stdout.String())
+	}
+	if strings.Contains(stdout.String(), "--allow-remote") {
+		t.Errorf("stdout = %q, should not suggest --allow-remote", stdout.String())
+	}
+}
+
+func TestConfirmIfLocalHostAllowRemote(t *testing.T) {
+	var stdout, stderr strings.Builder
+	c := newTestCLI(t, map[string]string{"SIA_SERVER_URL": "http://10.0.0.1:8080"})
+	c.stdout, c.stderr = &stdout, &stderr
+
+	// --allow-remote turns the error into a warning
+	c.confirmIfLocalHost(true)
+	if !strings.Contains(stderr.String(), "Warning: 10.0.0.1 is not a loopback address") {
+		t.Errorf("stderr = %q, want a warning", stderr.String())
+	}
+
+	// without it the command exits
+	exited := false
+	c.exit = func(code int) {
+		exited = true
+		panic(exitSignal{code: code})
+	}
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				if _, ok := r.(exitSignal); !ok {
+					panic(r)
+				}
+			}
+		}()
+		c.confirmIfLocalHost(false)
+	}()
+	if !exited {
+		t.Error("confirmIfLocalHost(false) did not exit for a remote server")
+	}
+	if !strings.Contains(stdout.String(), "Use --allow-remote to override") {
+		t.Errorf("stdout = %q, want the --allow-remote hint", stdout.String())
+	}
+}
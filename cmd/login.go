@@ -6,60 +6,100 @@ import (
 	"github.com/spf13/cobra"
 )
 
-// Password flag variable
-var loginPassword string
-
-// loginCmd represents the login command
-var loginCmd = &cobra.Command{
-	Use:   "login",
-	Short: "Log into SIA servers",
-	Long: `
+// loginOptions are the password flags of the login command
+type loginOptions struct {
+	password             string
+	passwordStdin        bool
+	passwordFile         string
+	insecurePasswordFlag bool
+}
+
+// newLoginCmd builds the login command
+func newLoginCmd(c *cli) *cobra.Command {
+	// Password flag variables
+	var opts loginOptions
+
+	cmd := &cobra.Command{
+		Use:   "login",
+		Short: "Log into SIA servers",
+		Long: `
 1. To log into your SIA servers as an admin.
-2. If the password is not part of the command, the app will prompt you for it.`,
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		checkEnvVars()
-	},
-	Run: func(cmd *cobra.Command, args []string) {
-
-		// Check if the password flag was provided
-		if loginPassword == "" {
-			// otherwise prompt the user
-			loginPassword = readHiddenTextInput("Enter Admin Password:")
-		}
+2. The password is read, in order, from --password-stdin, --password-file, the SIA_ADMIN_PASSWORD
+   environment variable or the credential_helper of the profile. Otherwise the app will prompt you for it.
+3. In CI, where there is no terminal to prompt on, use for example:
+     echo "$ADMIN_PASSWORD" | sia login --password-stdin
+4. --password shows the password in 'ps' and the shell history, so it needs --insecure-password-flag.`,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			c.checkEnvVars()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
 
-		// set the login URL
-		loginURL := "/api/auth/login"
+			// log in and save the token
+			c.loginWithPassword(c.resolveLoginPassword(cmd, opts))
 
-		// Create the payload as JSON
-		payload := map[string]string{
-			"password": loginPassword,
-		}
+			// Print the successful response
+			fmt.Fprintln(c.stdout, "You are logged in.")
+			fmt.Fprintln(c.stdout)
+		},
+	}
 
-		// Get the request body
-		reqBody := generateJSONBody(payload)
+	cmd.Flags().StringVarP(&opts.password, "password", "p", "", "Password for admin login (insecure, needs --insecure-password-flag)")
+	cmd.Flags().BoolVar(&opts.passwordStdin, "password-stdin", false, "Read the password from stdin")
+	cmd.Flags().StringVar(&opts.passwordFile, "password-file", "", "Read the password from a file")
+	cmd.Flags().BoolVar(&opts.insecurePasswordFlag, "insecure-password-flag", false, "Allow the password to be given with --password")
+	cmd.MarkFlagsMutuallyExclusive("password", "password-stdin", "password-file")
 
-		// Create the POST request
-		req := createHttpClient("POST", loginURL, reqBody, "application/json")
+	return cmd
+}
 
-		// Execute HTTP client
-		res, resBody := executeHttpRequest(req)
+// resolveLoginPassword reads the password from the flags, the environment,
+// the credential helper or the terminal, in that order
+func (c *cli) resolveLoginPassword(cmd *cobra.Command, opts loginOptions) string {
+	// the password flag leaks the password to other users and the history
+	if cmd.Flags().Changed("password") {
+		if !opts.insecurePasswordFlag {
+			c.handleErr(nil, "--password shows the password to other users in 'ps' and is saved in the shell history. Use --password-stdin or --password-file instead, or add --insecure-password-flag")
+		}
+		return opts.password
+	}
+	if opts.passwordStdin {
+		return c.readPasswordStdin()
+	}
+	if opts.passwordFile != "" {
+		return c.readPasswordFile(opts.passwordFile)
+	}
+	if password, _ := c.adminPasswordFromEnv(); password != "" {
+		return password
+	}
+	if !c.isInteractive() {
+		c.handleErr(nil, "No terminal to prompt for the password. Use --password-stdin, --password-file, SIA_ADMIN_PASSWORD or a credential_helper")
+	}
+	return c.readHiddenTextInput("Enter Admin Password:")
+}
 
-		//Check status code
-		checkResponseStatusCode(res, resBody)
+// loginWithPassword logs in as the admin and saves the access token,
+// returning it for requests to be retried with
+func (c *cli) loginWithPassword(password string) string {
+	// set the login URL
+	loginURL := "/api/auth/login"
 
-		// retrieve token from cookie
-		retrieveTokenAndSave(res)
+	// Create the payload as JSON
+	payload := map[string]string{
+		"password": password,
+	}
 
-		// Print the successful response
-		fmt.Println("You are logged in.")
-		fmt.Println()
-	},
-}
+	// Get the request body
+	reqBody := c.generateJSONBody(payload)
+
+	// Create the POST request
+	req := c.createHttpClient("POST", loginURL, reqBody, "application/json")
+
+	// Execute HTTP client
+	res, resBody := c.executeHttpRequest(req)
 
-func init() {
-	// Add the password flag
-	loginCmd.Flags().StringVarP(&loginPassword, "password", "p", "", "Password for admin login")
+	//Check status code
+	c.checkResponseStatusCode(res, resBody)
 
-	// Add the `login` command to the root command
-	rootCmd.AddCommand(loginCmd)
+	// retrieve token from cookie
+	return c.retrieveTokenAndSave(res)
 }
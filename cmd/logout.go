@@ -7,26 +7,26 @@ import (
 	"github.com/spf13/cobra"
 )
 
-var logoutCmd = &cobra.Command{
-	Use:   "logout",
-	Short: "Log out from SIA servers",
-	Long:  `Log out from SIA servers, clearing any auth tokens.`,
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		checkEnvVars()
-	},
-	Run: func(cmd *cobra.Command, args []string) {
+func newLogoutCmd(c *cli) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "logout",
+		Short: "Log out from SIA servers",
+		Long:  `Log out from SIA servers, clearing any auth tokens.`,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			c.checkEnvVars()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
 
-		// Check if access token exists
-		checkAccessToken()
+			// Check if access token exists
+			c.checkAccessToken()
 
-		// delete access token
-		deleteAccessToken()
+			// delete access token
+			c.deleteAccessToken()
 
-		fmt.Println("successfully logged out")
-		fmt.Println()
-	},
-}
+			fmt.Fprintln(c.stdout, "successfully logged out")
+			fmt.Fprintln(c.stdout)
+		},
+	}
 
-func init() {
-	rootCmd.AddCommand(logoutCmd)
+	return cmd
 }
@@ -0,0 +1,466 @@
+package cmd
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ANSI styles used when rendering Markdown
+const (
+	ansiReset   = "\033[0m"
+	ansiBold    = "\033[1m"
+	ansiDim     = "\033[2m"
+	ansiItalic  = "\033[3m"
+	ansiHeading = "\033[1;35m"
+	ansiCode    = "\033[36m"
+	ansiLink    = "\033[4;34m"
+	ansiKeyword = "\033[1;34m"
+	ansiString  = "\033[32m"
+	ansiNumber  = "\033[33m"
+	ansiComment = "\033[2;37m"
+)
+
+var (
+	mdFencePattern   = regexp.MustCompile("^\\s*(```|~~~)\\s*([\\w+#.-]*)")
+	mdHeadingPattern = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	mdRulePattern    = regexp.MustCompile(`^\s*([-*_])(\s*([-*_]))+\s*$`)
+	mdListPattern    = regexp.MustCompile(`^(\s*)([-*+]|\d+[.)])\s+(.*)$`)
+	mdQuotePattern   = regexp.MustCompile(`^\s*>\s?(.*)$`)
+	mdTableSeparator = regexp.MustCompile(`^\s*\|?\s*:?-{3,}:?\s*(\|\s*:?-{3,}:?\s*)*\|?\s*$`)
+	mdInlinePattern  = regexp.MustCompile("`[^`]+`|\\*\\*[^*]+\\*\\*|__[^_]+__|\\*[^*\\s][^*]*\\*|\\[[^\\]]+\\]\\([^)\\s]+\\)")
+)
+
+// colorEnabled reports whether ANSI colors may be written to stdout
+func (c *cli) colorEnabled() bool {
+	if _, ok := c.lookupEnv("NO_COLOR"); ok {
+		return false
+	}
+	_, ok := terminalFd(c.stdout)
+	return ok
+}
+
+// markdownRenderer renders Markdown for the terminal, wrapping to width
+type markdownRenderer struct {
+	width int
+	color bool
+}
+
+// mdPiece is a run of text with a single style
+type mdPiece struct {
+	text  string
+	style string
+}
+
+// mdWord is a sequence of pieces with no space between them
+type mdWord []mdPiece
+
+func (r markdownRenderer) render(text string) string {
+	// a narrow terminal still gets one character per line
+	r.width = max(r.width, 1)
+
+	var out []string
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	var paragraph []string
+
+	flush := func() {
+		if len(paragraph) > 0 {
+			out = append(out, r.wrap(r.inline(strings.Join(paragraph, " "), ""), "", "")...)
+			paragraph = nil
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		// fenced code block
+		if match := mdFencePattern.FindStringSubmatch(line); match != nil {
+			flush()
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), match[1]); i++ {
+				code = append(code, lines[i])
+			}
+			out = append(out, r.codeBlock(code, strings.ToLower(match[2]))...)
+			continue
+		}
+
+		// table: a row of pipes followed by a separator row
+		if strings.Contains(line, "|") && i+1 < len(lines) && mdTableSeparator.MatchString(lines[i+1]) {
+			flush()
+			rows := [][]string{splitTableRow(line)}
+			for i += 2; i < len(lines) && strings.Contains(lines[i], "|") && strings.TrimSpace(lines[i]) != ""; i++ {
+				rows = append(rows, splitTableRow(lines[i]))
+			}
+			i--
+			out = append(out, r.table(rows)...)
+			continue
+		}
+
+		switch {
+		case trimmed == "":
+			flush()
+			if len(out) > 0 && out[len(out)-1] != "" {
+				out = append(out, "")
+			}
+		case mdHeadingPattern.MatchString(trimmed):
+			flush()
+			heading := mdHeadingPattern.FindStringSubmatch(trimmed)[2]
+			out = append(out, r.wrap(r.inline(heading, ansiHeading), "", "")...)
+		case mdRulePattern.MatchString(trimmed):
+			flush()
+			out = append(out, r.style(strings.Repeat("─", r.width), ansiDim))
+		case mdQuotePattern.MatchString(line):
+			flush()
+			quote := mdQuotePattern.FindStringSubmatch(line)[1]
+			prefix := r.style("│ ", ansiDim)
+			out = append(out, r.wrap(r.inline(quote, ansiItalic), prefix, prefix)...)
+		case mdListPattern.MatchString(line):
+			flush()
+			match := mdListPattern.FindStringSubmatch(line)
+			indent := strings.Repeat(" ", len(strings.ReplaceAll(match[1], "\t", "  ")))
+			bullet := match[2]
+			if bullet == "-" || bullet == "*" || bullet == "+" {
+				bullet = "•"
+			}
+			first := indent + bullet + " "
+			rest := strings.Repeat(" ", utf8.RuneCountInString(first))
+			out = append(out, r.wrap(r.inline(match[3], ""), first, rest)...)
+		default:
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	flush()
+
+	// drop trailing blank lines
+	for len(out) > 0 && out[len(out)-1] == "" {
+		out = out[:len(out)-1]
+	}
+	return strings.Join(out, "\n")
+}
+
+func (r markdownRenderer) style(text, style string) string {
+	if !r.color || style == "" || text == "" {
+		return text
+	}
+	return style + text + ansiReset
+}
+
+// inline splits text into words, styling code, emphasis and links
+func (r markdownRenderer) inline(text, base string) []mdWord {
+	var pieces []mdPiece
+	last := 0
+	for _, loc := range mdInlinePattern.FindAllStringIndex(text, -1) {
+		pieces = append(pieces, mdPiece{text[last:loc[0]], base})
+		token := text[loc[0]:loc[1]]
+		switch {
+		case strings.HasPrefix(token, "`"):
+			code := token
+			if r.color {
+				code = token[1 : len(token)-1]
+			}
+			pieces = append(pieces, mdPiece{code, ansiCode})
+		case strings.HasPrefix(token, "**") || strings.HasPrefix(token, "__"):
+			pieces = append(pieces, mdPiece{token[2 : len(token)-2], base + ansiBold})
+		case strings.HasPrefix(token, "*"):
+			pieces = append(pieces, mdPiece{token[1 : len(token)-1], base + ansiItalic})
+		default:
+			// [text](url) shows the text followed by the url
+			close := strings.Index(token, "](")
+			pieces = append(pieces, mdPiece{token[1:close], ansiLink})
+			pieces = append(pieces, mdPiece{" (" + token[close+2:len(token)-1] + ")", ansiDim})
+		}
+		last = loc[1]
+	}
+	pieces = append(pieces, mdPiece{text[last:], base})
+
+	// split the pieces into words on spaces
+	var words []mdWord
+	var current mdWord
+	for _, piece := range pieces {
+		for i, part := range strings.Split(piece.text, " ") {
+			if i > 0 && len(current) > 0 {
+				words = append(words, current)
+				current = nil
+			}
+			if part != "" {
+				current = append(current, mdPiece{part, piece.style})
+			}
+		}
+	}
+	if len(current) > 0 {
+		words = append(words, current)
+	}
+	return words
+}
+
+// wrap lays out words within the width using a prefix for the first and
+// following lines. The line breaks come from wrapText on the plain words and
+// the styles are put back on the characters of each line
+func (r markdownRenderer) wrap(words []mdWord, first, rest string) []string {
+	// the styled characters of the words, in order
+	type styledRune struct {
+		char  rune
+		style string
+	}
+	var chars []styledRune
+	plain := make([]string, len(words))
+	for i, word := range words {
+		for _, piece := range word {
+			for _, char := range piece.text {
+				chars = append(chars, styledRune{char, piece.style})
+			}
+			plain[i] += piece.text
+		}
+	}
+
+	width := r.width - max(visibleWidth(first), visibleWidth(rest))
+	var lines []string
+	prefix := first
+	next := 0
+	for _, line := range wrapText(strings.Join(plain, " "), max(width, 1)) {
+		var builder strings.Builder
+		var run strings.Builder
+		runStyle := ""
+		flushRun := func() {
+			builder.WriteString(r.style(run.String(), runStyle))
+			run.Reset()
+		}
+		for _, char := range line {
+			// wrapText joins the words with single spaces, which are not styled
+			if unicode.IsSpace(char) {
+				flushRun()
+				builder.WriteRune(' ')
+				continue
+			}
+			for next < len(chars) && unicode.IsSpace(chars[next].char) {
+				next++
+			}
+			if next >= len(chars) {
+				break
+			}
+			if chars[next].style != runStyle {
+				flushRun()
+				runStyle = chars[next].style
+			}
+			run.WriteRune(chars[next].char)
+			next++
+		}
+		flushRun()
+		lines = append(lines, prefix+builder.String())
+		prefix = rest
+	}
+	return lines
+}
+
+func (r markdownRenderer) codeBlock(code []string, language string) []string {
+	var lines []string
+	for _, line := range code {
+		line = strings.ReplaceAll(line, "\t", "    ")
+		if r.color {
+			line = highlightCode(line, language)
+		}
+		lines = append(lines, "  "+line)
+	}
+	return lines
+}
+
+func splitTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	line = strings.TrimSuffix(line, "|")
+	cells := strings.Split(line, "|")
+	for i := range cells {
+		cells[i] = strings.TrimSpace(cells[i])
+	}
+	return cells
+}
+
+func (r markdownRenderer) table(rows [][]string) []string {
+	// render the cells and measure the columns
+	columns := 0
+	for _, row := range rows {
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+	rendered := make([][]string, len(rows))
+	widths := make([]int, columns)
+	for i, row := range rows {
+		rendered[i] = make([]string, columns)
+		for j := 0; j < columns; j++ {
+			cell := ""
+			if j < len(row) {
+				style := ""
+				if i == 0 {
+					style = ansiBold
+				}
+				cell = strings.Join(r.wrap(r.inline(row[j], style), "", ""), " ")
+			}
+			rendered[i][j] = cell
+			if w := visibleWidth(cell); w > widths[j] {
+				widths[j] = w
+			}
+		}
+	}
+
+	total := 1
+	for _, w := range widths {
+		total += w + 3
+	}
+	// too wide to lay out, show one "header: value" line per cell instead
+	if total > r.width {
+		var lines []string
+		for _, row := range rendered[1:] {
+			for j, cell := range row {
+				header := ""
+				if j < len(rows[0]) {
+					header = rows[0][j] + ": "
+				}
+				lines = append(lines, r.wrap(r.inline(header+stripANSI(cell), ""), "", "  ")...)
+			}
+			lines = append(lines, "")
+		}
+		return lines
+	}
+
+	border := func(left, middle, right string) string {
+		var parts []string
+		for _, w := range widths {
+			parts = append(parts, strings.Repeat("─", w+2))
+		}
+		return r.style(left+strings.Join(parts, middle)+right, ansiDim)
+	}
+	bar := r.style("│", ansiDim)
+
+	lines := []string{border("┌", "┬", "┐")}
+	for i, row := range rendered {
+		var builder strings.Builder
+		builder.WriteString(bar)
+		for j, cell := range row {
+			builder.WriteString(" " + cell + strings.Repeat(" ", widths[j]-visibleWidth(cell)) + " " + bar)
+		}
+		lines = append(lines, builder.String())
+		if i == 0 {
+			lines = append(lines, border("├", "┼", "┤"))
+		}
+	}
+	lines = append(lines, border("└", "┴", "┘"))
+	return lines
+}
+
+var ansiPattern = regexp.MustCompile("\033\\[[0-9;]*m")
+
+func stripANSI(text string) string {
+	return ansiPattern.ReplaceAllString(text, "")
+}
+
+func visibleWidth(text string) int {
+	return utf8.RuneCountInString(stripANSI(text))
+}
+
+// codeKeywords lists the keywords highlighted for common languages
+var codeKeywords = map[string][]string{
+	"go":         {"break", "case", "chan", "const", "continue", "default", "defer", "else", "fallthrough", "for", "func", "go", "goto", "if", "import", "interface", "map", "package", "range", "return", "select", "struct", "switch", "type", "var", "nil", "true", "false"},
+	"python":     {"and", "as", "assert", "async", "await", "break", "class", "continue", "def", "del", "elif", "else", "except", "finally", "for", "from", "global", "if", "import", "in", "is", "lambda", "None", "nonlocal", "not", "or", "pass", "raise", "return", "True", "False", "try", "while", "with", "yield"},
+	"javascript": {"async", "await", "break", "case", "catch", "class", "const", "continue", "default", "delete", "do", "else", "export", "extends", "false", "finally", "for", "function", "if", "import", "in", "instanceof", "let", "new", "null", "return", "switch", "this", "throw", "true", "try", "typeof", "undefined", "var", "while", "yield", "interface", "type"},
+	"bash":       {"if", "then", "else", "elif", "fi", "for", "while", "do", "done", "case", "esac", "function", "in", "return", "export", "local", "echo"},
+	"sql":        {"SELECT", "FROM", "WHERE", "INSERT", "INTO", "VALUES", "UPDATE", "SET", "DELETE", "CREATE", "TABLE", "DROP", "ALTER", "JOIN", "LEFT", "RIGHT", "INNER", "OUTER", "ON", "AND", "OR", "NOT", "NULL", "AS", "GROUP", "BY", "ORDER", "LIMIT", "HAVING", "DISTINCT"},
+	"java":       {"abstract", "boolean", "break", "case", "catch", "class", "continue", "default", "do", "else", "enum", "extends", "final", "finally", "for", "if", "implements", "import", "instanceof", "int", "interface", "new", "null", "package", "private", "protected", "public", "return", "static", "super", "switch", "this", "throw", "throws", "try", "void", "while", "true", "false"},
+	"c":          {"auto", "break", "case", "char", "const", "continue", "default", "do", "double", "else", "enum", "extern", "float", "for", "goto", "if", "int", "long", "return", "short", "signed", "sizeof", "static", "struct", "switch", "typedef", "union", "unsigned", "void", "while", "NULL"},
+	"json":       {"true", "false", "null"},
+	"yaml":       {"true", "false", "null", "yes", "no"},
+}
+
+var codeLanguageAliases = map[string]string{
+	"golang": "go", "py": "python", "js": "javascript", "ts": "javascript", "typescript": "javascript",
+	"sh": "bash", "shell": "bash", "zsh": "bash", "console": "bash", "yml": "yaml", "cpp": "c", "c++": "c",
+	"kotlin": "java", "csharp": "java", "cs": "java",
+}
+
+// highlightCode colors keywords, strings, numbers and comments in one line of code
+func highlightCode(line, language string) string {
+	if alias, ok := codeLanguageAliases[language]; ok {
+		language = alias
+	}
+	keywords := map[string]bool{}
+	for _, keyword := range codeKeywords[language] {
+		keywords[keyword] = true
+		if language == "sql" {
+			keywords[strings.ToLower(keyword)] = true
+		}
+	}
+	var comments []string
+	switch language {
+	case "python", "bash", "yaml":
+		comments = []string{"#"}
+	case "sql":
+		comments = []string{"--"}
+	case "json", "":
+		comments = nil
+	default:
+		comments = []string{"//"}
+	}
+
+	var builder strings.Builder
+	runes := []rune(line)
+	for i := 0; i < len(runes); {
+		rest := string(runes[i:])
+
+		// comment to the end of the line
+		isComment := false
+		for _, marker := range comments {
+			if strings.HasPrefix(rest, marker) {
+				isComment = true
+			}
+		}
+		if isComment {
+			builder.WriteString(ansiComment + rest + ansiReset)
+			break
+		}
+
+		switch r := runes[i]; {
+		case r == '"' || r == '\'' || r == '`':
+			j := i + 1
+			for j < len(runes) && runes[j] != r {
+				if runes[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(runes) {
+				j = len(runes) - 1
+			}
+			builder.WriteString(ansiString + string(runes[i:j+1]) + ansiReset)
+			i = j + 1
+		case unicode.IsDigit(r) && (i == 0 || !isIdentRune(runes[i-1])):
+			j := i
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.' || runes[j] == 'x' || unicode.Is(unicode.ASCII_Hex_Digit, runes[j])) {
+				j++
+			}
+			builder.WriteString(ansiNumber + string(runes[i:j]) + ansiReset)
+			i = j
+		case isIdentRune(r):
+			j := i
+			for j < len(runes) && isIdentRune(runes[j]) {
+				j++
+			}
+			word := string(runes[i:j])
+			if keywords[word] {
+				builder.WriteString(ansiKeyword + word + ansiReset)
+			} else {
+				builder.WriteString(word)
+			}
+			i = j
+		default:
+			builder.WriteRune(r)
+			i++
+		}
+	}
+	return builder.String()
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestMarkdownRender checks the layout of Markdown without colors
+func TestMarkdownRender(t *testing.T) {
+	tests := []struct {
+		name  string
+		width int
+		text  string
+		want  string
+	}{
+		{"paragraph", 20, "one two three four five six", "one two three four\nfive six"},
+		{"list", 12, "- one two three four", "• one two\n  three four"},
+		{"quote", 12, "> one two three four", "│ one two\n│ three four"},
+		{"long word", 6, "abcdefghij", "abcdef\nghij"},
+		{"styled", 10, "**bold words** and `code`", "bold words\nand `code`"},
+		{"rule", 4, "---", "────"},
+		{"zero width", 0, "---\nab", "─\na\nb"},
+		{"negative width", -5, "---\nab", "─\na\nb"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := markdownRenderer{width: test.width}.render(test.text)
+			if got != test.want {
+				t.Errorf("render(%q) at width %d =\n%s\nwant\n%s", test.text, test.width, got, test.want)
+			}
+		})
+	}
+}
+
+// TestMarkdownRenderColor checks the styles stay on the words when they are
+// wrapped onto separate lines
+func TestMarkdownRenderColor(t *testing.T) {
+	got := markdownRenderer{width: 6, color: true}.render("**abc def**")
+	want := ansiBold + "abc" + ansiReset + "\n" + ansiBold + "def" + ansiReset
+	if got != want {
+		t.Errorf("render = %q, want %q", got, want)
+	}
+	if strings.Contains(stripANSI(got), "\033") {
+		t.Errorf("render left a broken escape sequence in %q", got)
+	}
+}
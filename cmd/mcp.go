@@ -0,0 +1,380 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const mcpProtocolVersion = "2024-11-05"
+
+// agentResourcePrefix is the URI prefix of the agent resources
+const agentResourcePrefix = "sia://agents/"
+
+// agentBackend is what the MCP server needs from SIA, so that it can be
+// exercised against a fake server or a stub
+type agentBackend interface {
+	ListAgents() ([]AgentResponse, error)
+	GetAgent(name string) (AgentResponse, error)
+	Chat(name, prompt string, messages []ChatMessage) (ChatResponse, error)
+}
+
+// siaBackend talks to the SIA server set up in the environment
+type siaBackend struct {
+	c *cli
+}
+
+func (b siaBackend) ListAgents() ([]AgentResponse, error) {
+	var agentsList []AgentResponse
+	err := b.c.requestAuthJSON(b.c.ctx, "GET", "/api/agents/", &agentsList)
+	return agentsList, err
+}
+
+func (b siaBackend) GetAgent(name string) (AgentResponse, error) {
+	var agent AgentResponse
+	err := b.c.requestAuthJSON(b.c.ctx, "GET", "/api/agents/"+url.PathEscape(name), &agent)
+	return agent, err
+}
+
+func (b siaBackend) Chat(name, prompt string, messages []ChatMessage) (ChatResponse, error) {
+	return b.c.requestChatPrompt(b.c.ctx, name, prompt, messages)
+}
+
+func newMCPCmd(c *cli) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "mcp",
+		Short: "Serve agents to AI assistants over the Model Context Protocol",
+		Long: `
+Serve agents to AI assistants over the Model Context Protocol (MCP) on stdin/stdout.
+
+1. The tool "ask_agent" sends a prompt to any agent. Each agent is also published as its own "ask_<agent>" tool.
+2. Agent definitions are published as read-only resources at sia://agents/<name>.
+3. Add it to your assistant's MCP configuration with the command "sia mcp" and the SIA_SERVER_URL and SIA_API_KEY environment variables.`,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			c.checkEnvVars()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			// stdout carries the protocol so logs go to stderr
+			logger := log.New(c.stderr, "sia mcp: ", log.LstdFlags)
+			server := newMCPServer(siaBackend{c: c}, logger)
+			if err := server.serve(c.stdin, c.stdout); err != nil {
+				logger.Print(err)
+				c.exit(ExitError)
+			}
+		},
+	}
+
+	return cmd
+}
+
+type mcpRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type mcpError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type mcpResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *mcpError       `json:"error,omitempty"`
+}
+
+type mcpTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+}
+
+type mcpContent struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type mcpToolResult struct {
+	Content []mcpContent `json:"content"`
+	IsError bool         `json:"isError"`
+}
+
+type mcpResource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType"`
+}
+
+type mcpResourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+// JSON-RPC error codes
+const (
+	mcpParseError     = -32700
+	mcpInvalidRequest = -32600
+	mcpMethodNotFound = -32601
+	mcpInvalidParams  = -32602
+)
+
+// mcpServer answers MCP requests one line of JSON at a time
+type mcpServer struct {
+	backend agentBackend
+	logger  *log.Logger
+}
+
+func newMCPServer(backend agentBackend, logger *log.Logger) *mcpServer {
+	return &mcpServer{backend: backend, logger: logger}
+}
+
+// serve reads requests from in until EOF and writes the responses to out
+func (s *mcpServer) serve(in io.Reader, out io.Writer) error {
+	reader := bufio.NewReader(in)
+	encoder := json.NewEncoder(out)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(strings.TrimSpace(string(line))) > 0 {
+			if response := s.handle(line); response != nil {
+				if err := encoder.Encode(response); err != nil {
+					return err
+				}
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// handle returns the response to one message, or nil for notifications
+func (s *mcpServer) handle(message []byte) *mcpResponse {
+	var request mcpRequest
+	if err := json.Unmarshal(message, &request); err != nil {
+		return &mcpResponse{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &mcpError{mcpParseError, "parse error"}}
+	}
+	if request.JSONRPC != "2.0" || request.Method == "" {
+		return &mcpResponse{JSONRPC: "2.0", ID: idOrNull(request.ID), Error: &mcpError{mcpInvalidRequest, "invalid request"}}
+	}
+
+	result, rpcErr := s.dispatch(request)
+	// notifications have no id and get no response
+	if request.ID == nil {
+		return nil
+	}
+	response := &mcpResponse{JSONRPC: "2.0", ID: request.ID}
+	if rpcErr != nil {
+		response.Error = rpcErr
+	} else if result == nil {
+		response.Result = map[string]interface{}{}
+	} else {
+		response.Result = result
+	}
+	return response
+}
+
+func idOrNull(id json.RawMessage) json.RawMessage {
+	if id == nil {
+		return json.RawMessage("null")
+	}
+	return id
+}
+
+func (s *mcpServer) dispatch(request mcpRequest) (interface{}, *mcpError) {
+	switch request.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"protocolVersion": mcpProtocolVersion,
+			"capabilities": map[string]interface{}{
+				"tools":     map[string]interface{}{"listChanged": false},
+				"resources": map[string]interface{}{"listChanged": false, "subscribe": false},
+			},
+			"serverInfo": map[string]interface{}{"name": "sia", "version": version},
+		}, nil
+	case "notifications/initialized", "notifications/cancelled":
+		return nil, nil
+	case "ping":
+		return map[string]interface{}{}, nil
+	case "tools/list":
+		return map[string]interface{}{"tools": s.tools()}, nil
+	case "tools/call":
+		return s.callTool(request.Params)
+	case "resources/list":
+		return s.listResources()
+	case "resources/templates/list":
+		return map[string]interface{}{"resourceTemplates": []map[string]interface{}{{
+			"uriTemplate": agentResourcePrefix + "{name}",
+			"name":        "agent",
+			"description": "Definition of a SIA agent",
+			"mimeType":    "application/json",
+		}}}, nil
+	case "resources/read":
+		return s.readResource(request.Params)
+	}
+	return nil, &mcpError{mcpMethodNotFound, fmt.Sprintf("method not found: %s", request.Method)}
+}
+
+var toolNamePattern = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// agentToolName returns the name of the tool for a single agent
+func agentToolName(agentName string) string {
+	return "ask_" + toolNamePattern.ReplaceAllString(agentName, "_")
+}
+
+func (s *mcpServer) tools() []mcpTool {
+	historySchema := map[string]interface{}{
+		"type":        "array",
+		"description": "Earlier messages of the conversation, oldest first",
+		"items": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"role":    map[string]interface{}{"type": "string", "enum": []string{"user", "assistant"}},
+				"content": map[string]interface{}{"type": "string"},
+			},
+			"required": []string{"role", "content"},
+		},
+	}
+	promptSchema := map[string]interface{}{"type": "string", "description": "The question to ask"}
+
+	tools := []mcpTool{{
+		Name:        "ask_agent",
+		Description: "Ask a SIA agent a question. The agent answers from its own documents and instructions.",
+		InputSchema: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"agent":   map[string]interface{}{"type": "string", "description": "Name of the agent"},
+				"prompt":  promptSchema,
+				"history": historySchema,
+			},
+			"required": []string{"agent", "prompt"},
+		},
+	}}
+
+	// one tool per agent, described by its welcome message
+	agents, err := s.backend.ListAgents()
+	if err != nil {
+		s.logger.Printf("could not list agents: %v", err)
+		return tools
+	}
+	for _, agent := range agents {
+		// an agent named "agent" is reachable through ask_agent already
+		if agentToolName(agent.Name) == "ask_agent" {
+			continue
+		}
+		description := fmt.Sprintf("Ask the SIA agent %s a question.", agent.Name)
+		if agent.WelcomeMessage != "" {
+			description += " " + agent.WelcomeMessage
+		}
+		tools = append(tools, mcpTool{
+			Name:        agentToolName(agent.Name),
+			Description: description,
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"prompt":  promptSchema,
+					"history": historySchema,
+				},
+				"required": []string{"prompt"},
+			},
+		})
+	}
+	return tools
+}
+
+func (s *mcpServer) callTool(params json.RawMessage) (interface{}, *mcpError) {
+	var call struct {
+		Name      string `json:"name"`
+		Arguments struct {
+			Agent   string        `json:"agent"`
+			Prompt  string        `json:"prompt"`
+			History []ChatMessage `json:"history"`
+		} `json:"arguments"`
+	}
+	if err := json.Unmarshal(params, &call); err != nil {
+		return nil, &mcpError{mcpInvalidParams, "invalid tool call"}
+	}
+
+	// work out the agent from the tool name
+	agentName := call.Arguments.Agent
+	if call.Name != "ask_agent" {
+		agentName = ""
+		if agents, err := s.backend.ListAgents(); err == nil {
+			for _, agent := range agents {
+				if agentToolName(agent.Name) == call.Name {
+					agentName = agent.Name
+				}
+			}
+		}
+		if agentName == "" {
+			return nil, &mcpError{mcpInvalidParams, fmt.Sprintf("unknown tool: %s", call.Name)}
+		}
+	}
+	if agentName == "" || strings.TrimSpace(call.Arguments.Prompt) == "" {
+		return nil, &mcpError{mcpInvalidParams, "agent and prompt are required"}
+	}
+
+	// the chat endpoint expects the current prompt at the end of the messages
+	messages := append([]ChatMessage{}, call.Arguments.History...)
+	messages = append(messages, ChatMessage{Role: "user", Content: call.Arguments.Prompt})
+	response, err := s.backend.Chat(agentName, call.Arguments.Prompt, messages)
+	if err != nil {
+		// tool failures are reported in the result so the assistant can see them
+		return mcpToolResult{Content: []mcpContent{{Type: "text", Text: err.Error()}}, IsError: true}, nil
+	}
+	return mcpToolResult{Content: []mcpContent{{Type: "text", Text: response.Content}}}, nil
+}
+
+func (s *mcpServer) listResources() (interface{}, *mcpError) {
+	agents, err := s.backend.ListAgents()
+	if err != nil {
+		return nil, &mcpError{mcpInvalidRequest, err.Error()}
+	}
+	resources := []mcpResource{}
+	for _, agent := range agents {
+		resources = append(resources, mcpResource{
+			URI:         agentResourcePrefix + agent.Name,
+			Name:        agent.Name,
+			Description: agent.WelcomeMessage,
+			MimeType:    "application/json",
+		})
+	}
+	return map[string]interface{}{"resources": resources}, nil
+}
+
+func (s *mcpServer) readResource(params json.RawMessage) (interface{}, *mcpError) {
+	var read struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(params, &read); err != nil || !strings.HasPrefix(read.URI, agentResourcePrefix) {
+		return nil, &mcpError{mcpInvalidParams, "unknown resource"}
+	}
+
+	agent, err := s.backend.GetAgent(strings.TrimPrefix(read.URI, agentResourcePrefix))
+	if err != nil {
+		return nil, &mcpError{mcpInvalidParams, err.Error()}
+	}
+	text, err := json.MarshalIndent(agent, "", "  ")
+	if err != nil {
+		return nil, &mcpError{mcpInvalidRequest, err.Error()}
+	}
+	return map[string]interface{}{"contents": []mcpResourceContents{{
+		URI:      read.URI,
+		MimeType: "application/json",
+		Text:     string(text),
+	}}}, nil
+}
@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"sia-cli/internal/fakeserver"
+)
+
+// TestSIABackend runs the MCP backend against the fake server, whose errors
+// must be returned to the MCP client instead of ending the server
+func TestSIABackend(t *testing.T) {
+	server := fakeserver.New(fakeserver.Options{
+		APIKey:        "test-key",
+		AdminPassword: "test-password",
+		Script:        map[string]string{"What is in the notes?": "Notes."},
+		Now:           func() time.Time { return goldenClock },
+	})
+	server.AddAgent(fakeserver.Agent{Name: "kb", Instructions: "Answer questions about the notes."})
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	c := newTestCLI(t, map[string]string{"SIA_SERVER_URL": ts.URL, "SIA_API_KEY": "test-key"})
+	backend := siaBackend{c: c}
+
+	// listing needs a login
+	if _, err := backend.ListAgents(); err == nil {
+		t.Fatal("ListAgents without a login: got no error")
+	}
+	c.loginWithPassword("test-password")
+
+	agents, err := backend.ListAgents()
+	if err != nil {
+		t.Fatalf("ListAgents: %v", err)
+	}
+	if len(agents) != 1 || agents[0].Name != "kb" {
+		t.Errorf("ListAgents = %+v, want the agent kb", agents)
+	}
+
+	agent, err := backend.GetAgent("kb")
+	if err != nil {
+		t.Fatalf("GetAgent(kb): %v", err)
+	}
+	if agent.Instructions != "Answer questions about the notes." {
+		t.Errorf("GetAgent(kb).Instructions = %q", agent.Instructions)
+	}
+
+	// the name is escaped, so it cannot add a query or a path to the URL
+	for _, name := range []string{"kb?x=1", "kb/../kb", "missing"} {
+		if _, err := backend.GetAgent(name); err == nil {
+			t.Errorf("GetAgent(%q): got no error", name)
+		}
+	}
+
+	response, err := backend.Chat("kb", "What is in the notes?", []ChatMessage{{Role: "user", Content: "What is in the notes?"}})
+	if err != nil {
+		t.Fatalf("Chat: %v", err)
+	}
+	if response.Content != "Notes." {
+		t.Errorf("Chat content = %q, want %q", response.Content, "Notes.")
+	}
+
+	// a request that cannot be built is an error too
+	c.lookupEnv = func(key string) (string, bool) {
+		if key == "SIA_SERVER_URL" {
+			return "http://[::1", true
+		}
+		return "", false
+	}
+	if _, err := backend.GetAgent("kb"); err == nil {
+		t.Error("GetAgent with an invalid server URL: got no error")
+	}
+}
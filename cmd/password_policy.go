@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	_ "embed"
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+// commonPasswords is the bundled list of passwords that are easy to guess
+var commonPasswords = parseCommonPasswords(commonPasswordsFile)
+
+// PasswordPolicy is the local policy for new admin passwords, set with
+// password_policy in a profile of ~/.sia/config.yaml
+type PasswordPolicy struct {
+	MinLength    int  `yaml:"min_length"`
+	MinClasses   int  `yaml:"min_classes"` // of lower case, upper case, digits and symbols
+	RejectCommon bool `yaml:"reject_common"`
+	MinStrength  int  `yaml:"min_strength"` // 0 (very weak) to 4 (very strong)
+}
+
+// defaultPasswordPolicy is used when the profile does not set one
+func defaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:    8,
+		MinClasses:   2,
+		RejectCommon: true,
+		MinStrength:  2,
+	}
+}
+
+// Labels of the password strength scores
+var strengthLabels = []string{"very weak", "weak", "fair", "strong", "very strong"}
+
+// checkPasswordPolicy returns the reasons the password breaks the policy.
+// current is the password being replaced, or "" when setting the first one
+func checkPasswordPolicy(policy PasswordPolicy, password, current string) []string {
+	var problems []string
+	if length := len([]rune(password)); length < policy.MinLength {
+		problems = append(problems, fmt.Sprintf("it must have at least %d characters, it has %d", policy.MinLength, length))
+	}
+	if classes := countCharClasses(password); classes < policy.MinClasses {
+		problems = append(problems, fmt.Sprintf("it must mix at least %d of lower case, upper case, digits and symbols", policy.MinClasses))
+	}
+	if current != "" && password == current {
+		problems = append(problems, "it must not be the current password")
+	}
+	if policy.RejectCommon && isCommonPassword(password) {
+		problems = append(problems, "it is a common password that is easy to guess")
+	}
+	if score, _ := estimatePasswordStrength(password); score < clampScore(policy.MinStrength) {
+		problems = append(problems, fmt.Sprintf("it is %s, it must be at least %s", strengthLabels[score], strengthLabels[clampScore(policy.MinStrength)]))
+	}
+	return problems
+}
+
+// charClasses reports which classes of characters the password has
+func charClasses(password string) (lower, upper, digit, symbol bool) {
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	return lower, upper, digit, symbol
+}
+
+// countCharClasses counts the classes of characters in the password
+func countCharClasses(password string) int {
+	lower, upper, digit, symbol := charClasses(password)
+	count := 0
+	for _, present := range []bool{lower, upper, digit, symbol} {
+		if present {
+			count++
+		}
+	}
+	return count
+}
+
+// isCommonPassword checks the password, and the password without trailing
+// digits and symbols such as "Summer2024!", against the bundled list
+func isCommonPassword(password string) bool {
+	lower := strings.ToLower(password)
+	if commonPasswords[lower] {
+		return true
+	}
+	base := strings.TrimRightFunc(lower, func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	return len(base) >= 4 && commonPasswords[base]
+}
+
+// estimatePasswordStrength returns a score from 0 to 4 and the estimated
+// entropy in bits. The entropy of a random password of the same length and
+// character classes is reduced for repeated and sequential characters and
+// common passwords
+func estimatePasswordStrength(password string) (int, float64) {
+	if password == "" {
+		return 0, 0
+	}
+
+	// size of the alphabet the characters are drawn from
+	lower, upper, digit, symbol := charClasses(password)
+	alphabet := 0
+	if lower {
+		alphabet += 26
+	}
+	if upper {
+		alphabet += 26
+	}
+	if digit {
+		alphabet += 10
+	}
+	if symbol {
+		alphabet += 33
+	}
+
+	// characters repeating or continuing a sequence from the previous one add little
+	runes := []rune(password)
+	effective := 1.0
+	for i := 1; i < len(runes); i++ {
+		step := runes[i] - runes[i-1]
+		if step >= -1 && step <= 1 {
+			effective += 0.25
+			continue
+		}
+		effective++
+	}
+	bits := effective * math.Log2(float64(alphabet))
+	if isCommonPassword(password) {
+		bits = math.Min(bits, 10)
+	}
+
+	var score int
+	switch {
+	case bits < 28:
+		score = 0
+	case bits < 36:
+		score = 1
+	case bits < 60:
+		score = 2
+	case bits < 80:
+		score = 3
+	default:
+		score = 4
+	}
+	return score, bits
+}
+
+// enforcePasswordPolicy shows the strength of a new password and exits when
+// it breaks the policy of the active profile
+func (c *cli) enforcePasswordPolicy(password, current string) {
+	fmt.Fprintf(c.stdout, "Password strength: %s\n", describePasswordStrength(password))
+	problems := checkPasswordPolicy(c.profile.PasswordPolicy, password, current)
+	if len(problems) == 0 {
+		return
+	}
+	c.handleErr(nil, "The password does not meet the password policy:\n  - "+strings.Join(problems, "\n  - "))
+}
+
+// describePasswordStrength returns the strength estimate shown to the user
+func describePasswordStrength(password string) string {
+	score, bits := estimatePasswordStrength(password)
+	return fmt.Sprintf("%s (about %.0f bits)", strengthLabels[score], bits)
+}
+
+func clampScore(score int) int {
+	return max(0, min(score, len(strengthLabels)-1))
+}
+
+func parseCommonPasswords(list string) map[string]bool {
+	passwords := map[string]bool{}
+	for _, line := range strings.Split(list, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		passwords[line] = true
+	}
+	return passwords
+}
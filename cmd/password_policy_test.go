@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCheckPasswordPolicy checks each rule of the policy on its own
+func TestCheckPasswordPolicy(t *testing.T) {
+	// only the rule under test is set
+	lengthOnly := PasswordPolicy{MinLength: 10}
+	classesOnly := PasswordPolicy{MinClasses: 3}
+	commonOnly := PasswordPolicy{RejectCommon: true}
+	strengthOnly := PasswordPolicy{MinStrength: 3}
+
+	tests := []struct {
+		name     string
+		policy   PasswordPolicy
+		password string
+		current  string
+		want     []string
+	}{
+		{"long enough", lengthOnly, "abcdefghij", "", nil},
+		{"too short", lengthOnly, "abcdefghi", "", []string{"at least 10 characters, it has 9"}},
+		{"length in characters, not bytes", lengthOnly, "éééééééééé", "", nil},
+		{"three classes", classesOnly, "abcD1", "", nil},
+		{"symbols are a class", classesOnly, "abc!D", "", nil},
+		{"two classes", classesOnly, "abcD", "", []string{"at least 3 of lower case"}},
+		{"not common", commonOnly, "k8#Lq2!vZx", "", nil},
+		{"common", commonOnly, "dragon", "", []string{"common password"}},
+		{"common ignoring case", commonOnly, "DrAgOn", "", []string{"common password"}},
+		{"common with digits and symbols", commonOnly, "Dragon2024!", "", []string{"common password"}},
+		{"common allowed", PasswordPolicy{}, "dragon", "", nil},
+		{"strong", strengthOnly, "k8#Lq2!vZxR4", "", nil},
+		{"weak", strengthOnly, "abcdefgh", "", []string{"it is very weak, it must be at least strong"}},
+		{"strength out of range", PasswordPolicy{MinStrength: 9}, "k8#Lq2!vZx", "", []string{"must be at least very strong"}},
+		{"same as current", PasswordPolicy{}, "k8#Lq2!vZx", "k8#Lq2!vZx", []string{"not be the current password"}},
+		{"first password", PasswordPolicy{}, "k8#Lq2!vZx", "", nil},
+		{
+			"default policy", defaultPasswordPolicy(), "password1", "",
+			[]string{"common password", "it is very weak, it must be at least fair"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := checkPasswordPolicy(tt.policy, tt.password, tt.current)
+			if len(problems) != len(tt.want) {
+				t.Fatalf("problems = %q, want %d like %q", problems, len(tt.want), tt.want)
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(problems[i], want) {
+					t.Errorf("problem %d = %q, want %q", i, problems[i], want)
+				}
+			}
+		})
+	}
+}
+
+// TestIsCommonPassword checks the bundled list, also without trailing
+// digits and symbols, and that short words are not matched that way
+func TestIsCommonPassword(t *testing.T) {
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{"password", true},
+		{"PASSWORD", true},
+		{"123456", true},
+		{"Sunshine99", true},
+		{"letmein!!", true},
+		{"sunshines", false},
+		{"k8#Lq2!vZx", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := isCommonPassword(tt.password); got != tt.want {
+			t.Errorf("isCommonPassword(%q) = %v, want %v", tt.password, got, tt.want)
+		}
+	}
+}
+
+// TestEstimatePasswordStrength checks the score rises with length and mixed
+// characters, and falls for sequences and common passwords
+func TestEstimatePasswordStrength(t *testing.T) {
+	tests := []struct {
+		password string
+		want     int
+	}{
+		{"", 0},
+		{"abcdefgh", 0},
+		{"aaaaaaaaaaaaaaaa", 0},
+		{"Password2024!", 0},
+		{"qzmxnw", 1},
+		{"qzmxnwbv", 2},
+		{"qZ7#mX2!", 2},
+		{"qZ7#mX2!nW4$", 3},
+		{"qZ7#mX2!nW4$pL9&", 4},
+	}
+	for _, tt := range tests {
+		if got, bits := estimatePasswordStrength(tt.password); got != tt.want {
+			t.Errorf("estimatePasswordStrength(%q) = %d (%.0f bits), want %d", tt.password, got, bits, tt.want)
+		}
+	}
+}
+
+// TestPasswordPolicyFromProfile checks the policy of a profile is read over
+// the default policy, so that settings left out keep their defaults
+func TestPasswordPolicyFromProfile(t *testing.T) {
+	home := t.TempDir()
+	siaDir := filepath.Join(home, TokenDir)
+	if err := os.Mkdir(siaDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	config := "profiles:\n  default:\n    password_policy:\n      min_length: 16\n      reject_common: false\n"
+	if err := os.WriteFile(filepath.Join(siaDir, ConfigFilename), []byte(config), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	c := newTestCLI(t, map[string]string{"HOME": home, "USERPROFILE": home})
+	profile, err := c.loadProfile(DefaultProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := PasswordPolicy{MinLength: 16, MinClasses: 2, RejectCommon: false, MinStrength: 2}
+	if profile.PasswordPolicy != want {
+		t.Errorf("password policy = %+v, want %+v", profile.PasswordPolicy, want)
+	}
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// retryBaseWait is the wait before the first retry, doubled for every attempt
+const retryBaseWait = 500 * time.Millisecond
+
+// isIdempotentMethod reports whether a request can be repeated without side effects
+func isIdempotentMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// canRetryRequest reports whether the profile allows retrying the request.
+// POST and PUT are retried only when opted in and the body can be sent again
+func (c *cli) canRetryRequest(req *http.Request) bool {
+	if c.profile.Retries <= 0 {
+		return false
+	}
+	if isIdempotentMethod(req.Method) {
+		return true
+	}
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	return c.profile.RetryNonIdempotent && replayable
+}
+
+// retryWait decides whether a failed attempt should be retried and how long
+// to wait first. Connection errors and 429/502/503/504 responses are retried,
+// rejected certificates are not
+func (c *cli) retryWait(attempt int, res *http.Response, err error) (time.Duration, bool) {
+	if attempt >= c.profile.Retries {
+		return 0, false
+	}
+	if err != nil {
+		// give up straight away when the user cancelled or the cassette has no answer
+		if errors.Is(err, context.Canceled) || errors.Is(err, errNotRecorded) || isCertificateError(err) {
+			return 0, false
+		}
+		return c.backoffWait(attempt), true
+	}
+
+	switch res.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		if wait, ok := parseRetryAfter(res.Header.Get("Retry-After")); ok {
+			return min(wait, c.profile.RetryMaxWait), true
+		}
+		return c.backoffWait(attempt), true
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return c.backoffWait(attempt), true
+	}
+	return 0, false
+}
+
+// isCertificateError reports whether the certificate of the server was
+// rejected, which fails the same way however often it is tried
+func isCertificateError(err error) bool {
+	var verificationErr *tls.CertificateVerificationError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	var constraintErr x509.ConstraintViolationError
+	var criticalExtensionErr x509.UnhandledCriticalExtension
+	var algorithmErr x509.InsecureAlgorithmError
+	var systemRootsErr x509.SystemRootsError
+	return errors.As(err, &verificationErr) ||
+		errors.As(err, &unknownAuthorityErr) ||
+		errors.As(err, &hostnameErr) ||
+		errors.As(err, &invalidErr) ||
+		errors.As(err, &constraintErr) ||
+		errors.As(err, &criticalExtensionErr) ||
+		errors.As(err, &algorithmErr) ||
+		errors.As(err, &systemRootsErr)
+}
+
+// backoffWait returns an exponential backoff with full jitter, capped at the max wait
+func (c *cli) backoffWait(attempt int) time.Duration {
+	ceiling := retryBaseWait << attempt
+	if ceiling <= 0 || ceiling > c.profile.RetryMaxWait {
+		ceiling = c.profile.RetryMaxWait
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling))) + 1
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+// rewindRequestBody prepares the body of the request to be sent again
+func rewindRequestBody(req *http.Request) error {
+	if req.GetBody == nil {
+		return nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return err
+	}
+	req.Body = body
+	return nil
+}
+
+// describeFailure returns a short reason for a failed attempt
+func describeFailure(res *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return res.Status
+}
+
+func (c *cli) printRetry(req *http.Request, attempt int, wait time.Duration, reason string) {
+	fmt.Fprintf(c.stderr, "%s %s failed (%s), retrying in %s (%d/%d)\n",
+		req.Method, req.URL.Path, reason, wait.Round(time.Millisecond), attempt+1, c.profile.Retries)
+}
@@ -4,18 +4,85 @@ Copyright © 2024 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"bufio"
+	"context"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 )
 
 const version = "v0.1.0"
 
-var rootCmd = &cobra.Command{
-	Use:   "sia",
-	Short: "sia is a command line tool for managing your SIA servers",
-	Long: `
+// cli is one run of sia. It holds the streams, environment and working
+// directory of the run and everything set up from its flags and profile, so
+// that runs in the same process, as in the golden test, share nothing
+type cli struct {
+	stdin io.Reader
+	// stdinLines reads lines typed on stdin, see lineReader
+	stdinLines *bufio.Reader
+	stdout     io.Writer
+	stderr     io.Writer
+	lookupEnv  func(key string) (string, bool)
+	// dir is the working directory relative paths are resolved against, the
+	// one of the process when empty
+	dir string
+	// exit ends the run, os.Exit outside of tests
+	exit func(code int)
+	// ctx is cancelled on SIGINT/SIGTERM and every request is made with it
+	ctx context.Context
+	// completing is set while answering a completion request of the shell,
+	// which runs on every TAB and must not exit or prompt
+	completing bool
+
+	// the active profile, set up by initConfig before every command
+	profileName string
+	profile     Profile
+
+	// httpClient is shared by all requests so that connections are reused
+	httpClient *http.Client
+
+	// flags of the root command read by initConfig
+	verbosity  int
+	debugHTTP  bool
+	traceFile  string
+	recordFile string
+	replayFile string
+
+	// httpTrace collects the requests for --trace-file, nil when not tracing
+	httpTrace *harTrace
+	// httpCassette records the requests for --record or answers them for
+	// --replay, nil otherwise
+	httpCassette *cassette
+
+	// credentialStores caches the opened stores so a passphrase is asked for
+	// once. credentialMu guards it, the proxy servers open stores concurrently
+	credentialMu     sync.Mutex
+	credentialStores map[string]CredentialStore
+	// apiKey is the API key, looked up once
+	apiKeyOnce sync.Once
+	apiKey     string
+	apiKeyErr  error
+}
+
+// getenv returns the environment variable of the run, "" when it is not set
+func (c *cli) getenv(key string) string {
+	value, _ := c.lookupEnv(key)
+	return value
+}
+
+func newRootCmd(c *cli) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "sia",
+		Short: "sia is a command line tool for managing your SIA servers",
+		Long: `
 1. sia is a command line tool for managing your SIA servers. 
 2. It has commands to set up your intelligent agents.
 3. Ensure that the environment variable SIA_SERVER_URL and SIA_API_KEY is set before using this tool. 
@@ -29,30 +96,172 @@ var rootCmd = &cobra.Command{
      export SIA_API_KEY=the-access-key
    - On Windows:
      set SIA_API_KEYL=the-access-key
+6. Optional settings are read from profiles in ~/.sia/config.yaml. Select one with --profile or SIA_PROFILE:
+   profiles:
+     default:
+       retries: 3              # retries of failed GET and DELETE requests
+       retry_max_wait: 10s     # longest wait between retries
+       retry_non_idempotent: false # also retry POST and PUT requests
+       timeout: 0s             # timeout of each request, 0 for the defaults
+       ca_file: ~/certs/internal-ca.pem   # CA bundle to trust
+       client_cert: ~/certs/sia.crt       # client certificate for mutual TLS
+       client_key: ~/certs/sia.key
+       tls_server_name: sia.internal      # name to verify the certificate against
+       insecure_skip_tls_verify: false    # never in production
+       credential_store: keyring          # plaintext (default), keyring or encrypted-file
+       credential_helper: ~/bin/sia-creds # asked for secrets missing from the environment
+7. Ctrl-C cancels the requests in flight and exits with code 130. Commands that need a login exit with
+   code 3 when there is none or it has expired and sia cannot ask for the password.
+8. To debug failing requests, log them to stderr with -v, -vv, -vvv or --debug-http, or save them
+   with --trace-file trace.har to share with the server team. API keys, login cookies and
+   passwords are always redacted.
+   -v is short for --verbose. Earlier versions used it for --version, which has no short flag now.
+   To reproduce a problem elsewhere, save the requests and responses of a command with
+   --record cassette.json, and answer the same command from the file with --replay cassette.json.
+   Replaying needs no server or login, but SIA_SERVER_URL and SIA_API_KEY must be set to any value.
+9. A credential_helper is called when SIA_API_KEY, SIA_ADMIN_PASSWORD or the saved login are missing.
+   Like git and docker credential helpers, it reads a JSON request on stdin and writes the secret
+   as JSON on stdout, or nothing when it has none:
+     stdin:  {"server_url": "https://sia.example.com", "kind": "api_key", "profile": "default"}
+     stdout: {"secret": "the-access-key"}
+   kind is api_key, password or token.
 `,
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		checkEnvVars()
-	},
-	Run: func(cmd *cobra.Command, args []string) {
-		// Check if the version flag is set
-		versionFlag, _ := cmd.Flags().GetBool("version")
-		if versionFlag {
-			fmt.Println(version)
-			os.Exit(0)
-		}
-		cmd.Help()
-	},
+		PersistentPreRun: c.preRun,
+		Run: func(cmd *cobra.Command, args []string) {
+			// Check if the version flag is set
+			versionFlag, _ := cmd.Flags().GetBool("version")
+			if versionFlag {
+				fmt.Fprintln(c.stdout, version)
+				c.exit(0)
+			}
+			cmd.Help()
+		},
+	}
+
+	// Add the --version flag to the root command only (not persistent across subcommands).
+	// -v is the persistent --verbose flag
+	cmd.Flags().Bool("version", false, "Display the version of sia-cli")
+	c.addConfigFlags(cmd)
+	c.addDebugFlags(cmd)
+	c.addCassetteFlags(cmd)
+
+	cmd.AddCommand(
+		newAgentCmd(c),
+		newAuthCmd(c),
+		newBenchCmd(c),
+		newChangepwdCmd(c),
+		newCompletionCmd(c),
+		newDevCmd(c),
+		newLoginCmd(c),
+		newLogoutCmd(c),
+		newMCPCmd(c),
+		newServeCmd(c),
+		newSetpwdCmd(c),
+	)
+	return cmd
 }
 
+// preRun checks the environment before a command that talks to the SIA server
+func (c *cli) preRun(cmd *cobra.Command, args []string) {
+	// completion quietly completes nothing when the variables are not set
+	if isCompletionRequest(cmd) {
+		return
+	}
+	c.checkEnvVars()
+}
+
+// shutdownGracePeriod is how long the servers of serve and dev fake-server
+// let the requests in flight finish when they are stopped
+const shutdownGracePeriod = 3 * time.Second
+
+// cancelGracePeriod is how long a cancelled command has to stop by itself
+// before the process exits, e.g. when it is blocked reading the terminal.
+// It is longer than shutdownGracePeriod so a server can finish shutting down
+const cancelGracePeriod = shutdownGracePeriod + 2*time.Second
+
 func Execute() {
+	c := &cli{
+		stdin:     os.Stdin,
+		stdout:    os.Stdout,
+		stderr:    os.Stderr,
+		lookupEnv: os.LookupEnv,
+		exit:      os.Exit,
+	}
+
 	// rootCmd.CompletionOptions.DisableDefaultCmd = true
-	if err := rootCmd.Execute(); err != nil {
-		//fmt.Println(err)
-		os.Exit(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the first Ctrl-C cancels the requests in flight, a second one or the
+	// end of the grace period exits
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		cancel()
+		select {
+		case <-signals:
+		case <-time.After(cancelGracePeriod):
+		}
+		c.exitCancelled()
+	}()
+
+	if err := c.execute(ctx, os.Args[1:]); err != nil {
+		c.exit(ExitError)
 	}
 }
 
-func init() {
-	// Add the -v or --version flag to rootCmd only (not persistent across subcommands)
-	rootCmd.Flags().BoolP("version", "v", false, "Display the version of sia-cli")
+// setUp gives the run its context and the defaults that flags and the
+// profile change
+func (c *cli) setUp(ctx context.Context) {
+	c.ctx = ctx
+	c.profile = defaultProfile()
+	c.credentialStores = map[string]CredentialStore{}
+	c.httpClient = c.newHttpClient(defaultMaxConnsPerHost)
+}
+
+// execute builds the commands for this run and runs the one named by args.
+// The error is that of an unknown command or invalid flags and arguments,
+// which has been printed with the usage
+func (c *cli) execute(ctx context.Context, args []string) error {
+	c.setUp(ctx)
+	c.completing = len(args) > 0 && (args[0] == cobra.ShellCompRequestCmd || args[0] == cobra.ShellCompNoDescRequestCmd)
+
+	root := newRootCmd(c)
+	root.SetArgs(args)
+	root.SetIn(c.stdin)
+	root.SetOut(c.stdout)
+	root.SetErr(c.stderr)
+
+	// cobra prints usage and flag warnings to the output when it is set, so
+	// they are sent to stderr here as they would be by default
+	root.SilenceErrors = true
+	root.SilenceUsage = true
+	// the profile is set up before the PersistentPreRun cobra picks, which
+	// is that of the command or its nearest parent
+	var prepare func(cmd *cobra.Command)
+	prepare = func(cmd *cobra.Command) {
+		cmd.Flags().SetOutput(c.stderr)
+		if preRun := cmd.PersistentPreRun; preRun != nil {
+			cmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+				c.initConfig(cmd)
+				preRun(cmd, args)
+			}
+		}
+		for _, child := range cmd.Commands() {
+			prepare(child)
+		}
+	}
+	prepare(root)
+
+	cmd, err := root.ExecuteContextC(ctx)
+	if err != nil {
+		fmt.Fprintln(c.stderr, cmd.ErrPrefix(), err.Error())
+		if strings.HasPrefix(err.Error(), "unknown command") {
+			fmt.Fprintf(c.stderr, "Run '%v --help' for usage.\n", cmd.CommandPath())
+		} else {
+			fmt.Fprintln(c.stderr, cmd.UsageString())
+		}
+	}
+	return err
 }
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+// newTestCLI returns a run that only sees env, with its home directory in a
+// scratch directory. Output is discarded and exiting fails the test
+func newTestCLI(t *testing.T, env map[string]string) *cli {
+	t.Helper()
+	home := t.TempDir()
+	runEnv := map[string]string{"HOME": home, "USERPROFILE": home}
+	for key, value := range env {
+		runEnv[key] = value
+	}
+	c := &cli{
+		stdin:  strings.NewReader(""),
+		stdout: io.Discard,
+		stderr: io.Discard,
+		lookupEnv: func(key string) (string, bool) {
+			value, ok := runEnv[key]
+			return value, ok
+		},
+		dir:  t.TempDir(),
+		exit: func(code int) { t.Fatalf("exited with code %d", code) },
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	c.setUp(ctx)
+	return c
+}
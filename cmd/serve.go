@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// newServeCmd builds the serve parent command
+func newServeCmd(c *cli) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve SIA agents over other APIs",
+		Long: `
+Serve SIA agents locally over other APIs, such as the OpenAI Chat Completions API, so that existing tools can use them.`,
+
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			c.checkEnvVars()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+
+	cmd.AddCommand(
+		newServeOpenAICmd(c),
+	)
+	return cmd
+}
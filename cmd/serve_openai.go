@@ -0,0 +1,364 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// OpenAIMessage is a chat message; content may be a string or a list of parts
+type OpenAIMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+type OpenAIChatRequest struct {
+	Model    string          `json:"model"`
+	Messages []OpenAIMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+}
+
+type OpenAIChoiceMessage struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+type OpenAIChoice struct {
+	Index        int                  `json:"index"`
+	Message      *OpenAIChoiceMessage `json:"message,omitempty"`
+	Delta        *OpenAIChoiceMessage `json:"delta,omitempty"`
+	FinishReason *string              `json:"finish_reason"`
+}
+
+type OpenAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type OpenAIChatResponse struct {
+	ID      string         `json:"id"`
+	Object  string         `json:"object"`
+	Created int64          `json:"created"`
+	Model   string         `json:"model"`
+	Choices []OpenAIChoice `json:"choices"`
+	Usage   *OpenAIUsage   `json:"usage,omitempty"`
+}
+
+type OpenAIModel struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+type OpenAIModelList struct {
+	Object string        `json:"object"`
+	Data   []OpenAIModel `json:"data"`
+}
+
+func newServeOpenAICmd(c *cli) *cobra.Command {
+	var serveOpenAIListen string
+
+	cmd := &cobra.Command{
+		Use:   "openai",
+		Short: "Serve agents over an OpenAI-compatible API",
+		Long: `
+Serve agents over a local OpenAI-compatible API.
+
+1. POST /v1/chat/completions sends the messages to the agent named by "model". Streaming (SSE) is supported.
+2. GET /v1/models lists the agents on the SIA server.
+3. Requests to SIA use SIA_SERVER_URL, SIA_API_KEY and the token saved by 'sia login'.`,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			c.checkEnvVars()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// warn when reachable from other machines as there is no auth on the proxy
+			if !strings.HasPrefix(serveOpenAIListen, "127.0.0.1:") && !strings.HasPrefix(serveOpenAIListen, "localhost:") && !strings.HasPrefix(serveOpenAIListen, "[::1]:") {
+				fmt.Fprintf(c.stdout, "Warning: %s may be reachable from other machines and the proxy does not check credentials.\n", serveOpenAIListen)
+			}
+
+			// open the credential store now, so an encrypted file asks for its
+			// passphrase before serving instead of in the middle of a request
+			if _, err := c.readAccessToken(); err != nil && !errors.Is(err, errCredentialNotFound) {
+				c.handleErr(err, "Failed to read the access token")
+			}
+
+			fmt.Fprintf(c.stdout, "Serving the OpenAI-compatible API on http://%s/v1 (Ctrl-C to stop)\n", serveOpenAIListen)
+			server := &http.Server{Addr: serveOpenAIListen, Handler: c.newOpenAIHandler()}
+
+			// stop accepting requests on Ctrl-C and let the ones in flight finish
+			go func() {
+				<-cmd.Context().Done()
+				ctx, cancel := context.WithTimeout(context.Background(), shutdownGracePeriod)
+				defer cancel()
+				server.Shutdown(ctx)
+			}()
+
+			err := server.ListenAndServe()
+			if err != nil && err != http.ErrServerClosed {
+				c.handleErr(err, "Failed to start the server")
+			}
+			fmt.Fprintln(c.stdout, "Server stopped.")
+		},
+	}
+
+	cmd.Flags().StringVarP(&serveOpenAIListen, "listen", "l", "127.0.0.1:8787", "Address to listen on")
+
+	return cmd
+}
+
+// openAIProxy answers the OpenAI-compatible API with the SIA server of the run
+type openAIProxy struct {
+	c      *cli
+	logger *log.Logger
+}
+
+// newOpenAIHandler returns the routes of the OpenAI-compatible API
+func (c *cli) newOpenAIHandler() http.Handler {
+	proxy := &openAIProxy{c: c, logger: log.New(c.stderr, "", log.LstdFlags)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/chat/completions", proxy.handleChatCompletions)
+	mux.HandleFunc("/v1/models", proxy.handleModels)
+	return mux
+}
+
+func (p *openAIProxy) handleChatCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeOpenAIError(w, http.StatusMethodNotAllowed, "invalid_request_error", "only POST is supported")
+		return
+	}
+
+	var request OpenAIChatRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("invalid JSON body: %v", err))
+		return
+	}
+	if request.Model == "" {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", "model must be the name of a SIA agent")
+		return
+	}
+
+	// Translate the messages into the SIA chat request
+	prompt, messages, err := convertOpenAIMessages(request.Messages)
+	if err != nil {
+		writeOpenAIError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	start := time.Now()
+	response, err := p.c.requestChatPrompt(r.Context(), request.Model, prompt, messages)
+	if err != nil {
+		p.logger.Printf("chat %s failed: %v", request.Model, err)
+		status, errorType := openAIErrorStatus(err)
+		writeOpenAIError(w, status, errorType, err.Error())
+		return
+	}
+	p.logger.Printf("chat %s answered in %s", request.Model, time.Since(start).Round(time.Millisecond))
+
+	id := "chatcmpl-" + randomHex(12)
+	if request.Stream {
+		streamOpenAIResponse(w, id, request.Model, response.Content)
+		return
+	}
+
+	stop := "stop"
+	promptTokens := 0
+	for _, message := range messages {
+		promptTokens += estimateTokens(message.Content)
+	}
+	completionTokens := estimateTokens(response.Content)
+	writeJSON(w, http.StatusOK, OpenAIChatResponse{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   request.Model,
+		Choices: []OpenAIChoice{{
+			Message:      &OpenAIChoiceMessage{Role: "assistant", Content: response.Content},
+			FinishReason: &stop,
+		}},
+		Usage: &OpenAIUsage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: completionTokens,
+			TotalTokens:      promptTokens + completionTokens,
+		},
+	})
+}
+
+// convertOpenAIMessages returns the last user message as the prompt and the
+// user and assistant messages as the history, including the prompt
+func convertOpenAIMessages(openAIMessages []OpenAIMessage) (string, []ChatMessage, error) {
+	var messages []ChatMessage
+	for _, message := range openAIMessages {
+		// the agent's instructions take the place of system messages
+		if message.Role != "user" && message.Role != "assistant" {
+			continue
+		}
+		content, err := openAIMessageText(message.Content)
+		if err != nil {
+			return "", nil, err
+		}
+		messages = append(messages, ChatMessage{Role: message.Role, Content: content})
+	}
+	if len(messages) == 0 || messages[len(messages)-1].Role != "user" {
+		return "", nil, fmt.Errorf("the last message must be from the user")
+	}
+	return messages[len(messages)-1].Content, messages, nil
+}
+
+// openAIMessageText reads content given as a string or as a list of text parts
+func openAIMessageText(content json.RawMessage) (string, error) {
+	var text string
+	if err := json.Unmarshal(content, &text); err == nil {
+		return text, nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(content, &parts); err != nil {
+		return "", fmt.Errorf("message content must be a string or a list of parts")
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// streamOpenAIResponse sends the answer as server-sent events. SIA returns
+// whole answers, so the content is split into chunks of words
+func streamOpenAIResponse(w http.ResponseWriter, id, model, content string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	flusher, _ := w.(http.Flusher)
+	created := time.Now().Unix()
+
+	send := func(delta OpenAIChoiceMessage, finishReason *string) {
+		chunk := OpenAIChatResponse{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   model,
+			Choices: []OpenAIChoice{{Delta: &delta, FinishReason: finishReason}},
+		}
+		data, _ := json.Marshal(chunk)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	send(OpenAIChoiceMessage{Role: "assistant"}, nil)
+	for _, piece := range splitIntoChunks(content, 8) {
+		send(OpenAIChoiceMessage{Content: piece}, nil)
+	}
+	stop := "stop"
+	send(OpenAIChoiceMessage{}, &stop)
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
+
+// splitIntoChunks splits text after every few words keeping all whitespace
+func splitIntoChunks(text string, wordsPerChunk int) []string {
+	var chunks []string
+	words := 0
+	start := 0
+	for i := 1; i < len(text); i++ {
+		if text[i] != ' ' && text[i] != '\n' && (text[i-1] == ' ' || text[i-1] == '\n') {
+			words++
+			if words == wordsPerChunk {
+				chunks = append(chunks, text[start:i])
+				start = i
+				words = 0
+			}
+		}
+	}
+	if start < len(text) {
+		chunks = append(chunks, text[start:])
+	}
+	return chunks
+}
+
+func (p *openAIProxy) handleModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeOpenAIError(w, http.StatusMethodNotAllowed, "invalid_request_error", "only GET is supported")
+		return
+	}
+
+	var agentsList []AgentResponse
+	if err := p.c.requestAuthJSON(r.Context(), "GET", "/api/agents/", &agentsList); err != nil {
+		p.logger.Printf("models failed: %v", err)
+		status, errorType := openAIErrorStatus(err)
+		writeOpenAIError(w, status, errorType, err.Error())
+		return
+	}
+
+	models := OpenAIModelList{Object: "list", Data: []OpenAIModel{}}
+	for _, agent := range agentsList {
+		models.Data = append(models.Data, OpenAIModel{
+			ID:      agent.Name,
+			Object:  "model",
+			Created: agent.CreatedOn,
+			OwnedBy: "sia",
+		})
+	}
+	writeJSON(w, http.StatusOK, models)
+}
+
+// openAIErrorStatus returns the status and error type of a failed SIA
+// request: an unknown agent is an unknown model, requests that could not be
+// built are failures of the proxy and the others of the SIA server
+func openAIErrorStatus(err error) (int, string) {
+	var setupErr *requestSetupError
+	if errors.As(err, &setupErr) {
+		return http.StatusInternalServerError, "server_error"
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return http.StatusNotFound, "invalid_request_error"
+	}
+	return http.StatusBadGateway, "upstream_error"
+}
+
+func writeOpenAIError(w http.ResponseWriter, status int, errorType, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": message,
+			"type":    errorType,
+			"code":    nil,
+		},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// estimateTokens approximates the token count as SIA does not report usage
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,165 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"sia-cli/internal/fakeserver"
+)
+
+// TestOpenAIProxyStatus checks that failed chats are answered with a status
+// that tells the client whose fault it is, and that the proxy keeps running
+func TestOpenAIProxyStatus(t *testing.T) {
+	server := fakeserver.New(fakeserver.Options{
+		APIKey:        "test-key",
+		AdminPassword: "test-password",
+		Script:        map[string]string{"Hi": "Hello."},
+		Now:           func() time.Time { return goldenClock },
+	})
+	server.AddAgent(fakeserver.Agent{Name: "kb"})
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	tests := []struct {
+		name      string
+		serverURL string
+		model     string
+		status    int
+		errorType string
+	}{
+		{name: "answered", serverURL: ts.URL, model: "kb", status: http.StatusOK},
+		{name: "unknown model", serverURL: ts.URL, model: "missing", status: http.StatusNotFound, errorType: "invalid_request_error"},
+		{name: "model that is not a name", serverURL: ts.URL, model: "kb?x=1", status: http.StatusNotFound, errorType: "invalid_request_error"},
+		{name: "invalid server URL", serverURL: "http://[::1", model: "kb", status: http.StatusInternalServerError, errorType: "server_error"},
+		{name: "server down", serverURL: "http://127.0.0.1:1", model: "kb", status: http.StatusBadGateway, errorType: "upstream_error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestCLI(t, map[string]string{"SIA_SERVER_URL": tt.serverURL, "SIA_API_KEY": "test-key"})
+			c.profile.Retries = 0
+			handler := c.newOpenAIHandler()
+
+			body := `{"model": "` + tt.model + `", "messages": [{"role": "user", "content": "Hi"}]}`
+			req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.errorType == "" {
+				return
+			}
+			var response struct {
+				Error struct {
+					Type string `json:"type"`
+				} `json:"error"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if response.Error.Type != tt.errorType {
+				t.Errorf("error type = %q, want %q", response.Error.Type, tt.errorType)
+			}
+		})
+	}
+}
+
+// TestOpenAIProxyParallel answers requests in parallel, as the proxy does,
+// with the credential store opened by the first requests. Run with -race
+func TestOpenAIProxyParallel(t *testing.T) {
+	server := fakeserver.New(fakeserver.Options{
+		APIKey:        "test-key",
+		AdminPassword: "test-password",
+		Script:        map[string]string{"Hi": "Hello."},
+	})
+	server.AddAgent(fakeserver.Agent{Name: "kb"})
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	home := t.TempDir()
+	token := fakeServerLogin(t, ts.URL, "test-key", "test-password")
+	if err := os.Mkdir(filepath.Join(home, TokenDir), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, TokenDir, TokenFilename), []byte(token), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c := newTestCLI(t, map[string]string{"HOME": home, "USERPROFILE": home, "SIA_SERVER_URL": ts.URL, "SIA_API_KEY": "test-key"})
+	handler := c.newOpenAIHandler()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+			if rec.Code != http.StatusOK {
+				t.Errorf("models status = %d: %s", rec.Code, rec.Body)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			body := `{"model": "kb", "messages": [{"role": "user", "content": "Hi"}]}`
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)))
+			if rec.Code != http.StatusOK {
+				t.Errorf("chat status = %d: %s", rec.Code, rec.Body)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// TestOpenAIProxyClientGone checks the request to SIA is sent with the
+// context of the client's request, so a client that goes away cancels it
+func TestOpenAIProxyClientGone(t *testing.T) {
+	server := fakeserver.New(fakeserver.Options{APIKey: "test-key", Script: map[string]string{"Hi": "Hello."}})
+	server.AddAgent(fakeserver.Agent{Name: "kb"})
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	c := newTestCLI(t, map[string]string{"SIA_SERVER_URL": ts.URL, "SIA_API_KEY": "test-key"})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	body := `{"model": "kb", "messages": [{"role": "user", "content": "Hi"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body)).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	c.newOpenAIHandler().ServeHTTP(rec, req)
+
+	if !strings.Contains(rec.Body.String(), context.Canceled.Error()) {
+		t.Errorf("the chat was not cancelled with the client's request: %d %s", rec.Code, rec.Body)
+	}
+}
+
+// fakeServerLogin logs into the fake server and returns the access token
+func fakeServerLogin(t *testing.T, serverURL, apiKey, password string) string {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, serverURL+"/api/auth/login", strings.NewReader(`{"password": "`+password+`"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Requested-With", apiKey)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	for _, cookie := range res.Cookies() {
+		if cookie.Name == "access_token" {
+			return cookie.Value
+		}
+	}
+	t.Fatalf("login answered %s without an access token", res.Status)
+	return ""
+}
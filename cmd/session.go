@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// isSessionRequest reports whether the request was sent with the login cookie
+func isSessionRequest(req *http.Request) bool {
+	_, err := req.Cookie("access_token")
+	return err == nil
+}
+
+// refreshSessionAndRetry handles a 401 to a request sent with the login
+// cookie. It logs in again with SIA_ADMIN_PASSWORD, the password from the
+// credential helper or, on a terminal, the password the user enters, and
+// sends the request once more. Otherwise it exits with ExitAuth
+func (c *cli) refreshSessionAndRetry(req *http.Request, res *http.Response, body []byte) (*http.Response, []byte) {
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	password, source := c.adminPasswordFromEnv()
+	if (password == "" && !c.isInteractive()) || !replayable {
+		c.handleAuthErr(newAPIError(res, body).Describe())
+	}
+
+	fmt.Fprintln(c.stdout, "Your session has expired.")
+	if password == "" {
+		password = c.readHiddenTextInput("Enter Admin Password:")
+	} else {
+		fmt.Fprintf(c.stdout, "Logging in again with the password from %s.\n", source)
+	}
+	accessToken := c.loginWithPassword(password)
+
+	// send the request again with the new token
+	if err := rewindRequestBody(req); err != nil {
+		c.handleErr(err, "Failed to resend the request")
+	}
+	req.Header.Del("Cookie")
+	req.AddCookie(&http.Cookie{Name: "access_token", Value: accessToken})
+	res, body, err := c.doHttpRequest(req)
+	if err != nil {
+		c.handleErr(err, "Failed to execute HTTP request")
+	}
+	return res, body
+}
+
+// TokenClaims are the claims of a JWT access token used by sia auth status
+type TokenClaims struct {
+	Subject   string `json:"sub"`
+	ExpiresAt int64  `json:"exp"`
+	IssuedAt  int64  `json:"iat"`
+	Issuer    string `json:"iss"`
+}
+
+// decodeTokenClaims reads the claims of a JWT without verifying its
+// signature, which only the server can do
+func decodeTokenClaims(token string) (TokenClaims, error) {
+	var claims TokenClaims
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return claims, errors.New("the token is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return claims, fmt.Errorf("the token is not a JWT: %w", err)
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return claims, fmt.Errorf("the token is not a JWT: %w", err)
+	}
+	return claims, nil
+}
+
+// describeExpiry returns when a token expires relative to now
+func describeExpiry(expiresAt, now time.Time) string {
+	remaining := expiresAt.Sub(now)
+	when := expiresAt.Local().Format("2006-01-02 15:04:05 MST")
+	if remaining <= 0 {
+		return fmt.Sprintf("%s (expired %s ago)", when, formatDuration(-remaining))
+	}
+	return fmt.Sprintf("%s (in %s)", when, formatDuration(remaining))
+}
+
+// formatDuration rounds a duration to the two largest units, e.g. 3d 4h
+func formatDuration(d time.Duration) string {
+	days := int(d.Hours()) / 24
+	hours := int(d.Hours()) % 24
+	minutes := int(d.Minutes()) % 60
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	case minutes > 0:
+		return fmt.Sprintf("%dm", minutes)
+	}
+	return d.Round(time.Second).String()
+}
@@ -12,64 +12,89 @@ type SetPwInput struct {
 	RepeatPassword string
 }
 
-var pwInput SetPwInput
-
-// setpwdCmd represents the set password command
-var setpwdCmd = &cobra.Command{
-	Use:     "setpwd",
-	Short:   "Set the admin password",
-	Aliases: []string{"spw"},
-	Long: `
+// newSetpwdCmd builds the set password command
+func newSetpwdCmd(c *cli) *cobra.Command {
+	// Run against a server that is not on this machine
+	var setpwdAllowRemote bool
+	// Read the password from stdin instead of prompting
+	var setpwdPasswordStdin bool
+
+	cmd := &cobra.Command{
+		Use:     "setpwd",
+		Short:   "Set the admin password",
+		Aliases: []string{"spw"},
+		Long: `
 1. To set the admin password.
-2. This command can be used only from the server console not a remote terminal console.`,
-
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
-		checkEnvVars()
-	},
-	Run: func(cmd *cobra.Command, args []string) {
-
-		// confirm access is from server console
-		confirmIfLocalHost()
-
-		// Prompt for password
-		pwInput.Password = readHiddenTextInput("Enter a strong password (min 6 chars): ")
-		// prompt for repeat password
-		pwInput.RepeatPassword = readVisibleTextInput("Repeat above password: ")
-
-		// Check if passwords match
-		if pwInput.Password != pwInput.RepeatPassword {
-			fmt.Println("Passwords do not match.")
-			fmt.Println()
-			return
-		}
-
-		// set the login URL
-		setpwURL := "/api/auth/set-admin-password"
-
-		// Create the payload as JSON
-		payload := map[string]string{
-			"password": pwInput.Password,
-		}
-
-		// Get the request body
-		reqBody := generateJSONBody(payload)
-
-		// Create the POST request
-		req := createHttpClient("POST", setpwURL, reqBody, "application/json")
-
-		// Execute HTTP client
-		res, resBody := executeHttpRequest(req)
-
-		//Check status code
-		checkResponseStatusCode(res, resBody)
-
-		// Print the successful response
-		fmt.Println("Admin password successfully set. Login to proceed.")
-		fmt.Println()
-
-	},
-}
-
-func init() {
-	rootCmd.AddCommand(setpwdCmd)
+2. This command can be used only from the server console not a remote terminal console.
+3. SIA_SERVER_URL must be an http or https URL of localhost or a loopback address such as 127.0.0.1 or [::1].
+   Unix socket URLs are not supported.
+   Use --allow-remote to override this on a trusted network.
+4. The password is checked against the password_policy of the profile in ~/.sia/config.yaml:
+   password_policy:
+     min_length: 8        # characters
+     min_classes: 2       # of lower case, upper case, digits and symbols
+     reject_common: true  # reject passwords in the bundled list of common passwords
+     min_strength: 2      # 0 (very weak) to 4 (very strong)
+5. For automation, pipe the password in with --password-stdin.`,
+
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			c.checkEnvVars()
+		},
+		Run: func(cmd *cobra.Command, args []string) {
+
+			// confirm access is from server console
+			c.confirmIfLocalHost(setpwdAllowRemote)
+
+			var pwInput SetPwInput
+			if setpwdPasswordStdin {
+				// read the password piped in by automation
+				pwInput.Password = c.readPasswordStdin()
+			} else {
+				// Prompt for password
+				pwInput.Password = c.readHiddenTextInput(fmt.Sprintf("Enter a strong password (min %d chars): ", c.profile.PasswordPolicy.MinLength))
+				// prompt for repeat password
+				pwInput.RepeatPassword = c.readHiddenTextInput("Repeat above password: ")
+
+				// Check if passwords match
+				if pwInput.Password != pwInput.RepeatPassword {
+					fmt.Fprintln(c.stdout, "Passwords do not match.")
+					fmt.Fprintln(c.stdout)
+					return
+				}
+			}
+
+			// Check the password against the local policy
+			c.enforcePasswordPolicy(pwInput.Password, "")
+
+			// set the login URL
+			setpwURL := "/api/auth/set-admin-password"
+
+			// Create the payload as JSON
+			payload := map[string]string{
+				"password": pwInput.Password,
+			}
+
+			// Get the request body
+			reqBody := c.generateJSONBody(payload)
+
+			// Create the POST request
+			req := c.createHttpClient("POST", setpwURL, reqBody, "application/json")
+
+			// Execute HTTP client
+			res, resBody := c.executeHttpRequest(req)
+
+			//Check status code
+			c.checkResponseStatusCode(res, resBody)
+
+			// Print the successful response
+			fmt.Fprintln(c.stdout, "Admin password successfully set. Login to proceed.")
+			fmt.Fprintln(c.stdout)
+
+		},
+	}
+
+	cmd.Flags().BoolVar(&setpwdPasswordStdin, "password-stdin", false, "Read the password from stdin")
+	cmd.Flags().BoolVar(&setpwdAllowRemote, "allow-remote", false, "Allow SIA_SERVER_URL to be a remote server")
+
+	return cmd
 }
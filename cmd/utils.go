@@ -4,6 +4,9 @@ package cmd
 
 import (
 	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -18,16 +21,16 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
-func readAgentYamlFile(filePath string) AgentInputYaml {
-	yamlData, err := os.ReadFile(filePath)
+func (c *cli) readAgentYamlFile(filePath string) AgentInputYaml {
+	yamlData, err := os.ReadFile(c.workPath(filePath))
 	if err != nil {
-		handleErr(err, "Failed to read YAML file")
+		c.handleErr(err, "Failed to read YAML file")
 	}
 
 	var agentInput AgentInputYaml
 	err = yaml.Unmarshal(yamlData, &agentInput)
 	if err != nil {
-		handleErr(err, "Failed to decode YAML data")
+		c.handleErr(err, "Failed to decode YAML data")
 	}
 
 	return agentInput
@@ -53,33 +56,33 @@ func convertAgentInputToPushRequest(input AgentInputYaml) AgentPushRequest {
 	}
 }
 
-func createMultipartForm(agentRequest AgentPushRequest, input AgentInputYaml) (io.Reader, string) {
+func (c *cli) createMultipartForm(agentRequest AgentPushRequest, input AgentInputYaml) (io.Reader, string) {
 	var requestBody bytes.Buffer
 	writer := multipart.NewWriter(&requestBody)
 
 	// Add the JSON fields
 	err := writer.WriteField("name", agentRequest.Name)
 	if err != nil {
-		handleErr(err, "Failed to add name to form")
+		c.handleErr(err, "Failed to add name to form")
 	}
 	err = writer.WriteField("instructions", agentRequest.Instructions)
 	if err != nil {
-		handleErr(err, "Failed to add instructions to form")
+		c.handleErr(err, "Failed to add instructions to form")
 	}
 	err = writer.WriteField("welcome_message", agentRequest.WelcomeMessage)
 	if err != nil {
-		handleErr(err, "Failed to add welcome_message to form")
+		c.handleErr(err, "Failed to add welcome_message to form")
 	}
 	for _, prompt := range agentRequest.SuggestedPrompts {
 		err = writer.WriteField("suggested_prompts", prompt)
 		if err != nil {
-			handleErr(err, "Failed to add suggested prompt to form")
+			c.handleErr(err, "Failed to add suggested prompt to form")
 		}
 	}
 	for _, deletedFile := range agentRequest.DeletedFiles {
 		err = writer.WriteField("deleted_files", deletedFile)
 		if err != nil {
-			handleErr(err, "Failed to add deleted file to form")
+			c.handleErr(err, "Failed to add deleted file to form")
 		}
 	}
 
@@ -98,95 +101,262 @@ func createMultipartForm(agentRequest AgentPushRequest, input AgentInputYaml) (i
 	// Marshal the array of FileDetail structs to JSON
 	filesMetadataJSON, err := json.Marshal(filesArray)
 	if err != nil {
-		handleErr(err, "Failed to marshal FileDetail array to JSON")
+		c.handleErr(err, "Failed to marshal FileDetail array to JSON")
 	}
 
 	// Add the JSON-encoded files metadata to the form under the "files" field
 	err = writer.WriteField("files", string(filesMetadataJSON))
 	if err != nil {
-		handleErr(err, "Failed to add files metadata to form")
+		c.handleErr(err, "Failed to add files metadata to form")
 	}
 
 	// Add the actual files to be uploaded under "new_files" field
 	for _, newFile := range input.NewFiles {
-		resolvedPath := resolvePath(newFile.Filepath)
+		resolvedPath := c.resolvePath(newFile.Filepath)
 		file, err := os.Open(resolvedPath)
 		if err != nil {
-			handleErr(err, fmt.Sprintf("Failed to open file %s", newFile.Filepath))
+			c.handleErr(err, fmt.Sprintf("Failed to open file %s", newFile.Filepath))
 		}
 		defer file.Close()
 
 		// Create a form file for the multipart data
 		part, err := writer.CreateFormFile("new_files", filepath.Base(newFile.Filepath))
 		if err != nil {
-			handleErr(err, fmt.Sprintf("Failed to create form file for %s", newFile.Filepath))
+			c.handleErr(err, fmt.Sprintf("Failed to create form file for %s", newFile.Filepath))
 		}
 
 		_, err = io.Copy(part, file)
 		if err != nil {
-			handleErr(err, fmt.Sprintf("Failed to copy file data for %s", newFile.Filepath))
+			c.handleErr(err, fmt.Sprintf("Failed to copy file data for %s", newFile.Filepath))
 		}
 	}
 
 	// Close the writer
 	err = writer.Close()
 	if err != nil {
-		handleErr(err, "Failed to close the multipart writer")
+		c.handleErr(err, "Failed to close the multipart writer")
 	}
 
 	return &requestBody, writer.FormDataContentType()
 }
 
-func createHttpClient(method, url string, body io.Reader, contentType string) *http.Request {
-	serverUrl := os.Getenv(("SIA_SERVER_URL"))
+func (c *cli) createHttpClient(method, url string, body io.Reader, contentType string) *http.Request {
+	req, err := c.newRequest(c.ctx, method, url, body, contentType)
+	if err != nil {
+		c.handleErr(err, "Failed to create HTTP request")
+	}
+	return req
+}
+
+// requestSetupError is an error building a request, before anything was sent
+// to the server. Servers report it as their own failure, not the server's
+type requestSetupError struct {
+	err error
+}
+
+func (e *requestSetupError) Error() string { return e.err.Error() }
+
+func (e *requestSetupError) Unwrap() error { return e.err }
+
+// newRequest builds the request createHttpClient does, returning the error
+// instead of exiting for the servers, which must keep running. The servers
+// pass the context of the request they answer, so a client that goes away
+// cancels it
+func (c *cli) newRequest(ctx context.Context, method, url string, body io.Reader, contentType string) (*http.Request, error) {
+	serverUrl := c.getenv("SIA_SERVER_URL")
 	fullUrl := fmt.Sprintf("%s%s", serverUrl, url)
-	req, err := http.NewRequest(method, fullUrl, body)
+	req, err := http.NewRequestWithContext(ctx, method, fullUrl, body)
 	if err != nil {
-		handleErr(err, "Failed to create HTTP request")
+		return nil, &requestSetupError{err: err}
 	}
 
 	req.Header.Set("Content-Type", contentType)
 	// get API key
-	siaAPIKey := os.Getenv("SIA_API_KEY")
-	req.Header.Set("X-Requested-With", siaAPIKey)
-	return req
+	apiKey, err := c.lookupAPIKey()
+	if err != nil {
+		return nil, &requestSetupError{err: fmt.Errorf("failed to get the API key: %w", err)}
+	}
+	req.Header.Set("X-Requested-With", apiKey)
+	return req, nil
 }
 
-func createAuthHttpClient(method string, url string, body io.Reader, contentType string) *http.Request {
-	req := createHttpClient(method, url, body, contentType)
+func (c *cli) createAuthHttpClient(method string, url string, body io.Reader, contentType string) *http.Request {
+	req := c.createHttpClient(method, url, body, contentType)
 	// add cookie to header
-	accessToken := checkAccessToken()
+	accessToken := c.checkAccessToken()
 	if accessToken == nil {
 		err := errors.New("access token is not found")
-		handleErr(err, "No access token found")
+		c.handleErr(err, "No access token found")
 	}
 	req.AddCookie(&http.Cookie{Name: "access_token", Value: strings.TrimSpace(string(accessToken))})
 	return req
 }
 
-func executeHttpRequest(req *http.Request) (*http.Response, []byte) {
-	client := &http.Client{}
-	resp, err := client.Do(req)
+func (c *cli) executeHttpRequest(req *http.Request) (*http.Response, []byte) {
+	resp, responseBody, err := c.doHttpRequest(req)
+	if err != nil {
+		c.handleErr(err, "Failed to execute HTTP request")
+	}
+
+	// log in again and retry once when the session has expired
+	if resp.StatusCode == http.StatusUnauthorized && isSessionRequest(req) {
+		resp, responseBody = c.refreshSessionAndRetry(req, resp, responseBody)
+	}
+
+	return resp, responseBody
+}
+
+const defaultMaxConnsPerHost = 4
+
+// newHttpClient returns a client whose transport keeps up to maxConnsPerHost
+// idle connections open to the server and uses the TLS settings of the profile.
+// Requests are logged when -v, --debug-http or --trace-file is given, and
+// recorded or replayed with --record or --replay
+func (c *cli) newHttpClient(maxConnsPerHost int) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = maxConnsPerHost * 2
+	transport.MaxIdleConnsPerHost = maxConnsPerHost
+	transport.TLSClientConfig = c.newTLSConfig(c.profile)
+	return &http.Client{Transport: c.withDebugTransport(c.withCassette(transport))}
+}
+
+// newTLSConfig builds the TLS settings from the CA bundle, client certificate,
+// server name and verification settings of a profile
+func (c *cli) newTLSConfig(p Profile) *tls.Config {
+	config := &tls.Config{
+		ServerName:         p.TLSServerName,
+		InsecureSkipVerify: p.InsecureSkipTLSVerify,
+	}
+
+	// trust the given CA bundle on top of the system roots
+	if p.CAFile != "" {
+		caData, err := os.ReadFile(c.resolvePath(p.CAFile))
+		if err != nil {
+			c.handleErr(err, "Failed to read the CA file")
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(caData) {
+			c.handleErr(nil, fmt.Sprintf("No PEM certificates found in %s", p.CAFile))
+		}
+		config.RootCAs = pool
+	}
+
+	// client certificate for mutual TLS
+	if p.ClientCert != "" || p.ClientKey != "" {
+		if p.ClientCert == "" || p.ClientKey == "" {
+			c.handleErr(nil, "Both --client-cert and --client-key must be given for mutual TLS")
+		}
+		certificate, err := tls.LoadX509KeyPair(c.resolvePath(p.ClientCert), c.resolvePath(p.ClientKey))
+		if err != nil {
+			c.handleErr(err, "Failed to load the client certificate")
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	return config
+}
+
+// doHttpRequest executes the request and reads the whole body, returning
+// errors to the caller instead of exiting. Failed attempts are retried when
+// the active profile allows it
+func (c *cli) doHttpRequest(req *http.Request) (*http.Response, []byte, error) {
+	retry := c.canRetryRequest(req)
+	for attempt := 0; ; attempt++ {
+		resp, responseBody, err := c.doHttpAttempt(req)
+		if !retry {
+			return resp, responseBody, err
+		}
+		wait, ok := c.retryWait(attempt, resp, err)
+		if !ok {
+			return resp, responseBody, err
+		}
+		c.printRetry(req, attempt, wait, describeFailure(resp, err))
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return resp, responseBody, req.Context().Err()
+		}
+		if err := rewindRequestBody(req); err != nil {
+			return resp, responseBody, err
+		}
+	}
+}
+
+// Default timeouts of a request attempt, used unless --timeout is given
+const (
+	defaultRequestTimeout = 30 * time.Second
+	defaultChatTimeout    = 5 * time.Minute
+	defaultUploadTimeout  = 15 * time.Minute
+)
 
+// requestTimeout returns the timeout of one attempt at the request: long for
+// chat and agent uploads, short for everything else
+func (c *cli) requestTimeout(req *http.Request) time.Duration {
+	if c.profile.Timeout > 0 {
+		return c.profile.Timeout
+	}
+	switch {
+	case strings.Contains(req.URL.Path, "/api/chat/"):
+		return defaultChatTimeout
+	case strings.Contains(req.URL.Path, "/api/agents") && (req.Method == "POST" || req.Method == "PUT"):
+		return defaultUploadTimeout
+	}
+	return defaultRequestTimeout
+}
+
+// doHttpAttempt makes a single attempt at the request within its timeout
+func (c *cli) doHttpAttempt(req *http.Request) (*http.Response, []byte, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), c.requestTimeout(req))
+	defer cancel()
+
+	resp, err := c.httpClient.Do(req.WithContext(ctx))
 	if err != nil {
-		handleErr(err, "Failed to execute HTTP request")
+		return nil, nil, err
 	}
+	defer resp.Body.Close()
 
 	responseBody, err := io.ReadAll(resp.Body)
-	defer resp.Body.Close()
+	if err != nil {
+		return resp, nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	return resp, responseBody, nil
+}
 
+// requestAuthJSON sends an authenticated request and decodes the JSON reply
+// into out, returning errors instead of exiting so it can be used by servers
+func (c *cli) requestAuthJSON(ctx context.Context, method, url string, out interface{}) error {
+	req, err := c.newRequest(ctx, method, url, nil, "")
 	if err != nil {
-		handleErr(err, "Failed to read response body")
+		return err
 	}
+	accessToken, err := c.readAccessToken()
+	if err != nil {
+		return errors.New("login required. Use 'sia login'")
+	}
+	req.AddCookie(&http.Cookie{Name: "access_token", Value: accessToken})
 
-	return resp, responseBody
+	res, resBody, err := c.doHttpRequest(req)
+	if err != nil {
+		return err
+	}
+	if err := responseStatusError(res, resBody); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(resBody, out); err != nil {
+		return fmt.Errorf("failed to unmarshal response body: %w", err)
+	}
+	return nil
 }
 
-func unmarshalAgentResponse(responseBody []byte) AgentResponse {
+func (c *cli) unmarshalAgentResponse(responseBody []byte) AgentResponse {
 	var agentResponse AgentResponse
 	err := json.Unmarshal(responseBody, &agentResponse)
 	if err != nil {
-		handleErr(err, "Failed to unmarshal response body")
+		c.handleErr(err, "Failed to unmarshal response body")
 	}
 
 	return agentResponse
@@ -204,21 +374,21 @@ func convertAgentResponseToDisplay(response AgentResponse) AgentDisplay {
 	}
 }
 
-func displayAgentDetails(agentDisplay AgentDisplay) {
+func (c *cli) displayAgentDetails(agentDisplay AgentDisplay) {
 	yamlData, err := yaml.Marshal(agentDisplay)
 	if err != nil {
-		handleErr(err, "Failed to marshal agent details for display")
+		c.handleErr(err, "Failed to marshal agent details for display")
 	}
 
-	fmt.Println(string(yamlData))
+	fmt.Fprintln(c.stdout, string(yamlData))
 }
 
-func unmarshalAgentsListResponse(responseBody []byte) []AgentResponse {
+func (c *cli) unmarshalAgentsListResponse(responseBody []byte) []AgentResponse {
 	var agentsList []AgentResponse
 	err := json.Unmarshal(responseBody, &agentsList)
 	if err != nil {
-		fmt.Println(err)
-		handleErr(err, "Failed to unmarshal response body")
+		fmt.Fprintln(c.stdout, err)
+		c.handleErr(err, "Failed to unmarshal response body")
 	}
 
 	return agentsList
@@ -241,28 +411,28 @@ func convertAgentsListToDisplay(agentsList []AgentResponse) []AgentSummaryDispla
 	return displayList
 }
 
-func displayAgentsTable(agents []AgentSummaryDisplay) {
+func (c *cli) displayAgentsTable(agents []AgentSummaryDisplay) {
 	// Print the header row
 	headerFormat := "%-5s %-20s %-8s %-9s %-10s %-10s\n"
-	fmt.Printf(headerFormat, "SRNO", "NAME", "# FILES", "E STATUS", "CREATED ON", "UPDATED ON")
+	fmt.Fprintf(c.stdout, headerFormat, "SRNO", "NAME", "# FILES", "E STATUS", "CREATED ON", "UPDATED ON")
 
 	// Print a separator row for better readability
 	line := strings.Repeat("-", 67)
-	fmt.Println(line)
+	fmt.Fprintln(c.stdout, line)
 
 	// Print each agent's details
 	rowFormat := "%-5d %-20s %-8d %-9s %-10s %-10s\n"
 	for _, agent := range agents {
-		fmt.Printf(rowFormat, agent.Srno, agent.Name, agent.FileCount, agent.EmbeddingsStatus, agent.CreatedOn, agent.UpdatedOn)
+		fmt.Fprintf(c.stdout, rowFormat, agent.Srno, agent.Name, agent.FileCount, agent.EmbeddingsStatus, agent.CreatedOn, agent.UpdatedOn)
 	}
-	fmt.Println()
+	fmt.Fprintln(c.stdout)
 }
 
-func unmarshalAgentInputYaml(responseBody []byte) AgentInputYaml {
+func (c *cli) unmarshalAgentInputYaml(responseBody []byte) AgentInputYaml {
 	var agentResponse AgentResponse
 	err := json.Unmarshal(responseBody, &agentResponse)
 	if err != nil {
-		handleErr(err, "Failed to unmarshal response body")
+		c.handleErr(err, "Failed to unmarshal response body")
 	}
 
 	// Convert to AgentInputYaml (fill out the necessary fields)
@@ -276,11 +446,11 @@ func unmarshalAgentInputYaml(responseBody []byte) AgentInputYaml {
 	}
 }
 
-func unmarshalChatResponse(responseBody []byte) ChatResponse {
+func (c *cli) unmarshalChatResponse(responseBody []byte) ChatResponse {
 	var chatResponse ChatResponse
 	err := json.Unmarshal(responseBody, &chatResponse)
 	if err != nil {
-		handleErr(err, "Failed to unmarshal chat body")
+		c.handleErr(err, "Failed to unmarshal chat body")
 	}
 
 	return chatResponse
@@ -315,11 +485,11 @@ func addSampleNewFiles(agentInput *AgentInputYaml) {
 	}
 }
 
-func addCommentsToYaml(agentInput AgentInputYaml) string {
+func (c *cli) addCommentsToYaml(agentInput AgentInputYaml) string {
 	// Marshal the struct to YAML
 	yamlData, err := yaml.Marshal(agentInput)
 	if err != nil {
-		handleErr(err, "Failed to marshal AgentInputYaml")
+		c.handleErr(err, "Failed to marshal AgentInputYaml")
 	}
 
 	// Add comments to specific fields in the YAML
@@ -359,10 +529,10 @@ func addCommentsToYaml(agentInput AgentInputYaml) string {
 	return builder.String()
 }
 
-func saveYamlToFile(yamlData string, filename string) {
-	err := os.WriteFile(filename, []byte(yamlData), 0644)
+func (c *cli) saveYamlToFile(yamlData string, filename string) {
+	err := os.WriteFile(c.workPath(filename), []byte(yamlData), 0644)
 	if err != nil {
-		handleErr(err, "Failed to write YAML to file")
+		c.handleErr(err, "Failed to write YAML to file")
 	}
 }
 
@@ -375,33 +545,37 @@ func formatTimestamp(timestamp int64) string {
 	return t.Format("15-Jan-06")
 }
 
-func generateJSONBody(payload interface{}) *bytes.Buffer {
+func (c *cli) generateJSONBody(payload interface{}) *bytes.Buffer {
 	// Marshal the input payload to JSON
 	requestBody, err := json.Marshal(payload)
 	if err != nil {
-		handleErr(err, "Failed to marshal request payload")
+		c.handleErr(err, "Failed to marshal request payload")
 	}
 	// Wrap the marshaled JSON in a bytes.Buffer and return it
 	return bytes.NewBuffer(requestBody)
 }
 
-func checkResponseStatusCode(res *http.Response, body []byte) {
+func (c *cli) checkResponseStatusCode(res *http.Response, body []byte) {
 	// Check the response status code for success (200-299)
-	if res.StatusCode < 200 || res.StatusCode >= 300 {
-		// Parse the response body to extract the "detail" field
-		var errorResponse struct {
-			Detail string `json:"detail"`
-		}
-		err := json.Unmarshal(body, &errorResponse)
-		if err != nil {
-			handleErr(err, "Server error")
+	if err := responseStatusError(res, body); err != nil {
+		apiError := err.(*APIError)
+		if apiError.StatusCode == http.StatusUnauthorized {
+			c.handleAuthErr(apiError.Describe())
 		}
-		handleErr(err, errorResponse.Detail)
-		return
+		c.handleErr(nil, apiError.Describe())
 	}
 }
 
-func retrieveTokenAndSave(res *http.Response) {
+// responseStatusError is the non-exiting form of checkResponseStatusCode. It
+// returns an *APIError for responses outside 200-299
+func responseStatusError(res *http.Response, body []byte) error {
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
+	}
+	return newAPIError(res, body)
+}
+
+func (c *cli) retrieveTokenAndSave(res *http.Response) string {
 	var accessToken string
 	// retrieve access token from cookies
 	for _, cookie := range res.Cookies() {
@@ -413,8 +587,48 @@ func retrieveTokenAndSave(res *http.Response) {
 	// check if blank
 	if accessToken == "" {
 		err := errors.New("access token is blank")
-		handleErr(err, "No access token found")
+		c.handleErr(err, "No access token found")
 	}
 	// save it in local directory
-	saveAccessToken(accessToken)
+	c.saveAccessToken(accessToken)
+	return accessToken
+}
+
+// wrapText splits text into lines of at most width runes, breaking on
+// spaces where possible and keeping the existing line breaks
+func wrapText(text string, width int) []string {
+	var lines []string
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		words := strings.Fields(paragraph)
+		if len(words) == 0 {
+			lines = append(lines, "")
+			continue
+		}
+		line := ""
+		for _, word := range words {
+			// break words that are longer than a line
+			for len([]rune(word)) > width {
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				runes := []rune(word)
+				lines = append(lines, string(runes[:width]))
+				word = string(runes[width:])
+			}
+			switch {
+			case line == "":
+				line = word
+			case len([]rune(line))+1+len([]rune(word)) <= width:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
+			}
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
 }
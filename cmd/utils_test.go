@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writePEM writes one PEM block to a file in dir and returns its path
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newTLSTestCLI returns a run with the profile's TLS settings applied and
+// retries enabled, so that the test can check which errors are retried
+func newTLSTestCLI(t *testing.T, profile func(p *Profile)) *cli {
+	t.Helper()
+	c := newTestCLI(t, nil)
+	c.profile.Retries = 3
+	profile(&c.profile)
+	c.httpClient = c.newHttpClient(defaultMaxConnsPerHost)
+	return c
+}
+
+func TestTLSServerCertificate(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer ts.Close()
+	caFile := writePEM(t, t.TempDir(), "ca.pem", "CERTIFICATE", ts.Certificate().Raw)
+
+	tests := []struct {
+		name    string
+		profile func(p *Profile)
+		trusted bool
+	}{
+		{name: "system roots", profile: func(p *Profile) {}, trusted: false},
+		{name: "CA bundle", profile: func(p *Profile) { p.CAFile = caFile }, trusted: true},
+		{name: "CA bundle and another name", profile: func(p *Profile) {
+			p.CAFile = caFile
+			p.TLSServerName = "sia.internal"
+		}, trusted: false},
+		{name: "CA bundle and the name of the certificate", profile: func(p *Profile) {
+			p.CAFile = caFile
+			p.TLSServerName = "example.com"
+		}, trusted: true},
+		{name: "insecure", profile: func(p *Profile) { p.InsecureSkipTLSVerify = true }, trusted: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTLSTestCLI(t, tt.profile)
+			res, err := c.httpClient.Get(ts.URL)
+			if tt.trusted {
+				if err != nil {
+					t.Fatalf("GET: %v", err)
+				}
+				res.Body.Close()
+				return
+			}
+			if err == nil {
+				res.Body.Close()
+				t.Fatal("GET: got no error for an untrusted certificate")
+			}
+			if !isCertificateError(err) {
+				t.Errorf("isCertificateError(%v) = false", err)
+			}
+			if _, retry := c.retryWait(0, nil, err); retry {
+				t.Errorf("retryWait retries %v", err)
+			}
+		})
+	}
+}
+
+func TestTLSClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+
+	// a CA that signs the client certificate
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "sia test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "sia"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	clientDER, err := x509.CreateCertificate(rand.Reader, clientTemplate, caCert, &clientKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientKeyDER, err := x509.MarshalECPrivateKey(clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := writePEM(t, dir, "sia.crt", "CERTIFICATE", clientDER)
+	keyFile := writePEM(t, dir, "sia.key", "EC PRIVATE KEY", clientKeyDER)
+
+	// a server that only talks to clients with a certificate of the CA
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(caCert)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	ts.StartTLS()
+	defer ts.Close()
+	caFile := writePEM(t, dir, "ca.pem", "CERTIFICATE", ts.Certificate().Raw)
+
+	c := newTLSTestCLI(t, func(p *Profile) {
+		p.CAFile = caFile
+		p.ClientCert = certFile
+		p.ClientKey = keyFile
+	})
+	res, err := c.httpClient.Get(ts.URL)
+	if err != nil {
+		t.Fatalf("GET with the client certificate: %v", err)
+	}
+	res.Body.Close()
+
+	c = newTLSTestCLI(t, func(p *Profile) { p.CAFile = caFile })
+	res, err = c.httpClient.Get(ts.URL)
+	if err == nil {
+		res.Body.Close()
+		t.Fatal("GET without a client certificate: got no error")
+	}
+}
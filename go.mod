@@ -4,10 +4,17 @@ go 1.23.2
 
 require (
 	github.com/spf13/cobra v1.8.1
-	golang.org/x/term v0.25.0
+	github.com/zalando/go-keyring v0.2.6
+	golang.org/x/crypto v0.39.0
+	golang.org/x/term v0.32.0
 )
 
-require golang.org/x/sys v0.26.0 // indirect
+require (
+	al.essio.dev/pkg/shellescape v1.5.1 // indirect
+	github.com/danieljoos/wincred v1.2.2 // indirect
+	github.com/godbus/dbus/v5 v5.1.0 // indirect
+	golang.org/x/sys v0.33.0 // indirect
+)
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
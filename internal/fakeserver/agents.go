@@ -0,0 +1,248 @@
+package fakeserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// maxUploadSize is the largest multipart upload accepted
+const maxUploadSize = 64 << 20
+
+// agentNamePattern is the rule for agent names given in the create template
+var agentNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// handleAgents serves /api/agents/ (list and create) and /api/agents/{name}
+// (view, update and delete). Viewing one agent needs no login as chat uses it
+func (s *Server) handleAgents(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/agents/"), "/")
+
+	if name == "" {
+		if !allowMethods(w, r, http.MethodGet, http.MethodPost) || !s.authorize(w, r) {
+			return
+		}
+		if r.Method == http.MethodGet {
+			s.listAgents(w)
+			return
+		}
+		s.createAgent(w, r)
+		return
+	}
+
+	if !allowMethods(w, r, http.MethodGet, http.MethodPut, http.MethodDelete) {
+		return
+	}
+	if r.Method != http.MethodGet && !s.authorize(w, r) {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		agent, ok := s.Agent(name)
+		if !ok {
+			writeDetail(w, http.StatusNotFound, "Agent not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, agent)
+	case http.MethodPut:
+		s.updateAgent(w, r, name)
+	case http.MethodDelete:
+		s.mu.Lock()
+		_, ok := s.agents[name]
+		delete(s.agents, name)
+		s.mu.Unlock()
+		if !ok {
+			writeDetail(w, http.StatusNotFound, "Agent not found")
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"message": "Agent deleted"})
+	}
+}
+
+func (s *Server) listAgents(w http.ResponseWriter) {
+	s.mu.Lock()
+	agents := make([]Agent, 0, len(s.agents))
+	for _, agent := range s.agents {
+		agents = append(agents, agent.copy())
+	}
+	s.mu.Unlock()
+
+	sort.Slice(agents, func(i, j int) bool { return agents[i].ID < agents[j].ID })
+	writeJSON(w, http.StatusOK, agents)
+}
+
+func (s *Server) createAgent(w http.ResponseWriter, r *http.Request) {
+	form, ok := readAgentForm(w, r)
+	if !ok {
+		return
+	}
+	if !agentNamePattern.MatchString(form.name) {
+		writeValidationError(w, []string{"body", "name"}, "Name may only have letters, digits, hyphens and underscores", "string_pattern_mismatch")
+		return
+	}
+	if _, exists := s.Agent(form.name); exists {
+		writeDetail(w, http.StatusConflict, fmt.Sprintf("Agent %s already exists", form.name))
+		return
+	}
+
+	agent := Agent{Name: form.name}
+	form.apply(&agent)
+	s.AddAgent(agent)
+	created, _ := s.Agent(form.name)
+	writeJSON(w, http.StatusOK, created)
+}
+
+func (s *Server) updateAgent(w http.ResponseWriter, r *http.Request, name string) {
+	form, ok := readAgentForm(w, r)
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	agent, exists := s.agents[name]
+	if !exists {
+		writeDetail(w, http.StatusNotFound, "Agent not found")
+		return
+	}
+	// the agent cannot be renamed, the name in the form is ignored
+	form.apply(agent)
+	agent.UpdatedOn = s.opts.Now().Unix()
+	writeJSON(w, http.StatusOK, agent.copy())
+}
+
+// agentForm is the multipart form sent by sia agent push
+type agentForm struct {
+	name             string
+	instructions     string
+	welcomeMessage   string
+	suggestedPrompts []string
+	deletedFiles     []string
+	files            []FileDetail // metadata of the new files
+	contents         map[string][]byte
+}
+
+func readAgentForm(w http.ResponseWriter, r *http.Request) (agentForm, bool) {
+	form := agentForm{contents: map[string][]byte{}}
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+		writeValidationError(w, []string{"body"}, fmt.Sprintf("Expected a multipart form: %v", err), "multipart_invalid")
+		return form, false
+	}
+
+	form.name = r.FormValue("name")
+	if form.name == "" {
+		writeValidationError(w, []string{"body", "name"}, "Field required", "missing")
+		return form, false
+	}
+	form.instructions = r.FormValue("instructions")
+	form.welcomeMessage = r.FormValue("welcome_message")
+	form.suggestedPrompts = r.MultipartForm.Value["suggested_prompts"]
+	form.deletedFiles = r.MultipartForm.Value["deleted_files"]
+	if files := r.FormValue("files"); files != "" && files != "null" {
+		if err := json.Unmarshal([]byte(files), &form.files); err != nil {
+			writeValidationError(w, []string{"body", "files"}, "Input should be a JSON list of files", "json_invalid")
+			return form, false
+		}
+	}
+
+	for _, header := range r.MultipartForm.File["new_files"] {
+		file, err := header.Open()
+		if err != nil {
+			writeDetail(w, http.StatusBadRequest, fmt.Sprintf("Failed to read %s", header.Filename))
+			return form, false
+		}
+		content, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			writeDetail(w, http.StatusBadRequest, fmt.Sprintf("Failed to read %s", header.Filename))
+			return form, false
+		}
+		form.contents[header.Filename] = content
+	}
+	return form, true
+}
+
+// apply updates the agent with the form: deleted files are removed first,
+// then new files are added or replace files of the same name
+func (f agentForm) apply(agent *Agent) {
+	agent.Instructions = f.instructions
+	agent.WelcomeMessage = f.welcomeMessage
+	agent.SuggestedPrompts = f.suggestedPrompts
+	if agent.contents == nil {
+		agent.contents = map[string][]byte{}
+	}
+
+	deleted := map[string]bool{}
+	for _, filename := range f.deletedFiles {
+		deleted[filename] = true
+		delete(agent.contents, filename)
+	}
+	metas := map[string]Meta{}
+	for _, file := range f.files {
+		metas[file.Filename] = file.Meta
+	}
+
+	var files []FileDetail
+	for _, file := range agent.Files {
+		if _, replaced := f.contents[file.Filename]; !deleted[file.Filename] && !replaced {
+			files = append(files, file)
+		}
+	}
+	names := make([]string, 0, len(f.contents))
+	for filename := range f.contents {
+		names = append(names, filename)
+	}
+	sort.Strings(names)
+	for _, filename := range names {
+		files = append(files, FileDetail{Filename: filename, Meta: metas[filename]})
+		agent.contents[filename] = f.contents[filename]
+	}
+	agent.Files = files
+}
+
+// handleChat answers POST /api/chat/{agent} with the Chat function, a
+// scripted answer or an echo of the prompt
+func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/chat/"), "/")
+	agent, ok := s.Agent(name)
+	if !ok {
+		writeDetail(w, http.StatusNotFound, "Agent not found")
+		return
+	}
+
+	var request struct {
+		Prompt   string        `json:"prompt"`
+		Messages []ChatMessage `json:"messages"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeValidationError(w, []string{"body"}, "Input should be a valid JSON object", "json_invalid")
+		return
+	}
+	if request.Prompt == "" {
+		writeValidationError(w, []string{"body", "prompt"}, "Field required", "missing")
+		return
+	}
+
+	var content string
+	switch {
+	case s.opts.Chat != nil:
+		answer, err := s.opts.Chat(agent, request.Prompt, request.Messages)
+		if err != nil {
+			writeDetail(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		content = answer
+	case s.opts.Script[request.Prompt] != "":
+		content = s.opts.Script[request.Prompt]
+	default:
+		content = fmt.Sprintf("%s received: %s", agent.Name, request.Prompt)
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"role": "assistant", "content": content})
+}
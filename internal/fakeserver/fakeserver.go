@@ -0,0 +1,351 @@
+// Package fakeserver is an in-memory SIA server for tests and offline demos.
+//
+// It implements the endpoints used by the CLI: admin password and login
+// under /api/auth/, agent CRUD with multipart uploads under /api/agents/ and
+// chat under /api/chat/{agent}. In Go code it is an http.Handler:
+//
+//	server := fakeserver.New(fakeserver.Options{APIKey: "key", AdminPassword: "secret"})
+//	ts := httptest.NewServer(server)
+//	defer ts.Close()
+package fakeserver
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTokenTTL is how long a login lasts unless Options.TokenTTL is set
+const DefaultTokenTTL = time.Hour
+
+// ChatFunc answers a prompt sent to an agent
+type ChatFunc func(agent Agent, prompt string, messages []ChatMessage) (string, error)
+
+// Options configure a Server
+type Options struct {
+	// APIKey is required in the X-Requested-With header when set
+	APIKey string
+	// AdminPassword is the password to log in with. When empty the
+	// password has to be set with /api/auth/set-admin-password first
+	AdminPassword string
+	// TokenTTL is how long an access token is valid (default one hour)
+	TokenTTL time.Duration
+	// Script maps prompts to scripted answers. Other prompts are echoed
+	Script map[string]string
+	// Chat answers prompts instead of Script and the echo when set
+	Chat ChatFunc
+	// Now is the clock, time.Now when nil
+	Now func() time.Time
+}
+
+// Server is the fake SIA server. It is safe for concurrent use
+type Server struct {
+	opts Options
+	mux  *http.ServeMux
+
+	mu       sync.Mutex
+	password string
+	tokens   map[string]time.Time // access token to expiry
+	agents   map[string]*Agent
+	nextID   int64
+}
+
+// Agent is an agent as returned by the API
+type Agent struct {
+	ID               int64        `json:"ID"`
+	Name             string       `json:"name"`
+	Instructions     string       `json:"instructions"`
+	WelcomeMessage   string       `json:"welcome_message"`
+	SuggestedPrompts []string     `json:"suggested_prompts"`
+	Files            []FileDetail `json:"files"`
+	Status           string       `json:"status"`
+	EmbeddingsStatus string       `json:"embeddings_status"`
+	CreatedOn        int64        `json:"created_on"`
+	UpdatedOn        int64        `json:"updated_on"`
+
+	// contents of the uploaded files by name, not returned by the API
+	contents map[string][]byte
+}
+
+// FileDetail is an uploaded file and how it is split for embedding
+type FileDetail struct {
+	Filename string `json:"filename"`
+	Meta     Meta   `json:"meta"`
+}
+
+// Meta are the splitting settings of a file
+type Meta struct {
+	SplitBy        string `json:"split_by"`
+	SplitLength    int    `json:"split_length"`
+	SplitOverlap   int    `json:"split_overlap"`
+	SplitThreshold int    `json:"split_threshold"`
+}
+
+// ChatMessage is a message of the chat history
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// New returns a server with no agents
+func New(opts Options) *Server {
+	if opts.TokenTTL == 0 {
+		opts.TokenTTL = DefaultTokenTTL
+	}
+	if opts.Now == nil {
+		opts.Now = time.Now
+	}
+	s := &Server{
+		opts:     opts,
+		password: opts.AdminPassword,
+		tokens:   map[string]time.Time{},
+		agents:   map[string]*Agent{},
+	}
+
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("/api/auth/set-admin-password", s.handleSetPassword)
+	s.mux.HandleFunc("/api/auth/login", s.handleLogin)
+	s.mux.HandleFunc("/api/auth/update-admin-password", s.handleUpdatePassword)
+	s.mux.HandleFunc("/api/agents/", s.handleAgents)
+	s.mux.HandleFunc("/api/chat/", s.handleChat)
+	return s
+}
+
+// ServeHTTP checks the API key and routes the request
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if s.opts.APIKey != "" && r.Header.Get("X-Requested-With") != s.opts.APIKey {
+		writeDetail(w, http.StatusForbidden, "Invalid API key")
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// AddAgent adds or replaces an agent, e.g. to seed a test
+func (s *Server) AddAgent(agent Agent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	now := s.opts.Now().Unix()
+	agent.ID = s.nextID
+	if agent.CreatedOn == 0 {
+		agent.CreatedOn = now
+	}
+	if agent.UpdatedOn == 0 {
+		agent.UpdatedOn = now
+	}
+	if agent.Status == "" {
+		agent.Status = "active"
+	}
+	if agent.EmbeddingsStatus == "" {
+		agent.EmbeddingsStatus = "completed"
+	}
+	if agent.contents == nil {
+		agent.contents = map[string][]byte{}
+	}
+	s.agents[agent.Name] = &agent
+}
+
+// Agent returns a copy of the named agent
+func (s *Server) Agent(name string) (Agent, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	agent, ok := s.agents[name]
+	if !ok {
+		return Agent{}, false
+	}
+	return agent.copy(), true
+}
+
+// FileContent returns the content of a file uploaded to an agent
+func (s *Server) FileContent(agentName, filename string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	agent, ok := s.agents[agentName]
+	if !ok {
+		return nil, false
+	}
+	content, ok := agent.contents[filename]
+	return content, ok
+}
+
+// AdminPassword returns the current admin password
+func (s *Server) AdminPassword() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.password
+}
+
+// ExpireSessions ends all logins, as when the tokens expire
+func (s *Server) ExpireSessions() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens = map[string]time.Time{}
+}
+
+// readJSON decodes a JSON body, answering 422 like FastAPI when it is
+// invalid or misses one of the required fields
+func readJSON(w http.ResponseWriter, r *http.Request, required ...string) (map[string]string, bool) {
+	var body map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeValidationError(w, []string{"body"}, "Input should be a valid JSON object", "json_invalid")
+		return nil, false
+	}
+	for _, field := range required {
+		if body[field] == "" {
+			writeValidationError(w, []string{"body", field}, "Field required", "missing")
+			return nil, false
+		}
+	}
+	return body, true
+}
+
+func (s *Server) handleSetPassword(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+	body, ok := readJSON(w, r, "password")
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.password != "" {
+		writeDetail(w, http.StatusBadRequest, "Admin password has already been set")
+		return
+	}
+	if len(body["password"]) < 6 {
+		writeDetail(w, http.StatusBadRequest, "Password must have at least 6 characters")
+		return
+	}
+	s.password = body["password"]
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Admin password set"})
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+	body, ok := readJSON(w, r, "password")
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.password == "" {
+		writeDetail(w, http.StatusBadRequest, "Admin password has not been set. Use 'sia setpwd'")
+		return
+	}
+	if body["password"] != s.password {
+		writeDetail(w, http.StatusUnauthorized, "Invalid password")
+		return
+	}
+
+	expiry := s.opts.Now().Add(s.opts.TokenTTL)
+	token := newToken(expiry)
+	s.tokens[token] = expiry
+	http.SetCookie(w, &http.Cookie{Name: "access_token", Value: token, Path: "/", HttpOnly: true, Expires: expiry})
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Login successful"})
+}
+
+func (s *Server) handleUpdatePassword(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) || !s.authorize(w, r) {
+		return
+	}
+	body, ok := readJSON(w, r, "current_password", "new_password")
+	if !ok {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if body["current_password"] != s.password {
+		writeDetail(w, http.StatusBadRequest, "Current password is incorrect")
+		return
+	}
+	if len(body["new_password"]) < 6 {
+		writeDetail(w, http.StatusBadRequest, "Password must have at least 6 characters")
+		return
+	}
+	s.password = body["new_password"]
+	writeJSON(w, http.StatusOK, map[string]string{"message": "Admin password updated"})
+}
+
+// authorize checks the access_token cookie, answering 401 when it is
+// missing, unknown or expired
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) bool {
+	cookie, err := r.Cookie("access_token")
+	if err != nil {
+		writeDetail(w, http.StatusUnauthorized, "Not authenticated")
+		return false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	expiry, ok := s.tokens[cookie.Value]
+	if !ok {
+		writeDetail(w, http.StatusUnauthorized, "Invalid token")
+		return false
+	}
+	if !s.opts.Now().Before(expiry) {
+		delete(s.tokens, cookie.Value)
+		writeDetail(w, http.StatusUnauthorized, "Token expired")
+		return false
+	}
+	return true
+}
+
+// newToken returns an unsigned JWT so that clients can read its expiry
+func newToken(expiry time.Time) string {
+	encode := func(v interface{}) string {
+		data, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	header := encode(map[string]string{"alg": "none", "typ": "JWT"})
+	claims := encode(map[string]interface{}{"sub": "admin", "exp": expiry.Unix(), "jti": hex.EncodeToString(nonce)})
+	return header + "." + claims + "." + hex.EncodeToString(nonce)
+}
+
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeDetail(w, http.StatusMethodNotAllowed, "Method Not Allowed")
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeDetail(w http.ResponseWriter, status int, detail string) {
+	writeJSON(w, status, map[string]string{"detail": detail})
+}
+
+// writeValidationError answers like a FastAPI request validation error
+func writeValidationError(w http.ResponseWriter, loc []string, msg, errorType string) {
+	writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+		"detail": []map[string]interface{}{{"loc": loc, "msg": msg, "type": errorType}},
+	})
+}
+
+func (a *Agent) copy() Agent {
+	c := *a
+	c.SuggestedPrompts = append([]string(nil), a.SuggestedPrompts...)
+	c.Files = append([]FileDetail(nil), a.Files...)
+	c.contents = nil
+	return c
+}
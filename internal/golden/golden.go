@@ -0,0 +1,90 @@
+// Package golden compares output with the expected output kept in files.
+//
+//	if err := golden.Compare("testdata/golden/login.golden", output, update); err != nil {
+//		// err shows a line diff of the golden file and the output
+//	}
+package golden
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Compare checks got against the golden file at path. With update the file
+// is written with got instead, creating its directory when needed
+func Compare(path string, got []byte, update bool) error {
+	if update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		return os.WriteFile(path, got, 0644)
+	}
+
+	want, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%s does not exist, run with -update to create it", path)
+	}
+	if err != nil {
+		return err
+	}
+	if diff := Diff(string(want), string(got)); diff != "" {
+		return fmt.Errorf("output differs from %s (-want +got):\n%s", path, diff)
+	}
+	return nil
+}
+
+// Diff returns the lines removed from want with "-", the lines added in got
+// with "+" and the unchanged lines around them, or "" when both are equal
+func Diff(want, got string) string {
+	if want == got {
+		return ""
+	}
+	a, b := splitLines(want), splitLines(got)
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var diff strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			fmt.Fprintf(&diff, "  %s\n", a[i])
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			fmt.Fprintf(&diff, "+ %s\n", b[j])
+			j++
+		default:
+			fmt.Fprintf(&diff, "- %s\n", a[i])
+			i++
+		}
+	}
+	if diff.Len() == 0 {
+		// only the final newline differs
+		return "  (the files differ in the final newline)\n"
+	}
+	return diff.String()
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}